@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/olegshs/go-tools/config"
+	"github.com/olegshs/go-tools/events"
 	"github.com/olegshs/go-tools/session"
 )
 
@@ -70,3 +71,8 @@ func Restore(s session.SessionInterface, r *http.Request, w http.ResponseWriter)
 func PasswordHash(password string, salt string) string {
 	return DefaultManager().PasswordHash(password, salt)
 }
+
+// Events возвращает диспетчер событий аутентификации, см. Manager.Events.
+func Events() *events.Dispatcher {
+	return namespaceEvents
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"github.com/olegshs/go-tools/events"
+)
+
+const (
+	// Namespace — пространство имён событий аутентификации в events.Shared, например "auth.Login".
+	Namespace = "auth"
+)
+
+var (
+	// namespaceEvents — диспетчер пространства имён Namespace, через который
+	// события отправляют все менеджеры Manager.
+	namespaceEvents = events.Shared.Namespace(Namespace)
+)
+
+const (
+	EventLogin       = events.Event("Login")       // (session.SessionInterface, userId int64)
+	EventLoginFailed = events.Event("LoginFailed") // (session.SessionInterface, login string)
+	EventLogout      = events.Event("Logout")      // (session.SessionInterface, userId int64)
+	EventRestore     = events.Event("Restore")     // (session.SessionInterface, userId int64)
+)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/olegshs/go-tools/auth/token"
+	"github.com/olegshs/go-tools/events"
 	"github.com/olegshs/go-tools/helpers"
 	"github.com/olegshs/go-tools/helpers/typeconv"
 	"github.com/olegshs/go-tools/session"
@@ -16,6 +17,7 @@ type Manager struct {
 	conf           Config
 	userFactory    UserFactoryInterface
 	sessionManager session.ManagerInterface
+	events         *events.Dispatcher
 }
 
 func NewManager(conf Config, userFactory UserFactoryInterface, sessionManager session.ManagerInterface) ManagerInterface {
@@ -23,10 +25,17 @@ func NewManager(conf Config, userFactory UserFactoryInterface, sessionManager se
 	mgr.conf = conf
 	mgr.userFactory = userFactory
 	mgr.sessionManager = sessionManager
+	mgr.events = namespaceEvents
 
 	return mgr
 }
 
+// Events возвращает диспетчер событий аутентификации. Все менеджеры отправляют события
+// в общее пространство имён Namespace, поэтому слушатели получают события любого из них.
+func (mgr *Manager) Events() *events.Dispatcher {
+	return mgr.events
+}
+
 func (mgr *Manager) UserId(s session.SessionInterface) int64 {
 	return typeconv.Int64(s.Get(mgr.conf.Session.UserIdKey))
 }
@@ -69,21 +78,27 @@ func (mgr *Manager) Authenticate(login string, password string) bool {
 
 func (mgr *Manager) Login(s session.SessionInterface, w http.ResponseWriter, login string, password string) bool {
 	if !mgr.Authenticate(login, password) {
+		mgr.events.DispatchSync(EventLoginFailed, s, login)
 		return false
 	}
 
 	user := mgr.userFactory.UserByLogin(login)
 	if user == nil {
+		mgr.events.DispatchSync(EventLoginFailed, s, login)
 		return false
 	}
 
 	mgr.sessionManager.Restart(s, w)
 	mgr.SetUserId(s, user.Id())
 
+	mgr.events.DispatchSync(EventLogin, s, user.Id())
+
 	return true
 }
 
 func (mgr *Manager) Logout(s session.SessionInterface, w http.ResponseWriter) {
+	id := mgr.UserId(s)
+
 	mgr.sessionManager.Restart(s, w)
 
 	c := new(http.Cookie)
@@ -95,6 +110,8 @@ func (mgr *Manager) Logout(s session.SessionInterface, w http.ResponseWriter) {
 	c.Expires = time.Now().Add(-time.Hour * 24)
 	c.HttpOnly = true
 	http.SetCookie(w, c)
+
+	mgr.events.DispatchSync(EventLogout, s, id)
 }
 
 func (mgr *Manager) Remember(s session.SessionInterface, r *http.Request, w http.ResponseWriter, rememberIP bool) {
@@ -202,6 +219,8 @@ func (mgr *Manager) Restore(s session.SessionInterface, r *http.Request, w http.
 	mgr.sessionManager.Restart(s, w)
 	mgr.SetUserId(s, user.Id())
 
+	mgr.events.DispatchSync(EventRestore, s, user.Id())
+
 	return user
 }
 
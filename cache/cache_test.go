@@ -0,0 +1,751 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olegshs/go-tools/cache/codec"
+	"github.com/olegshs/go-tools/cache/drivers/file"
+	"github.com/olegshs/go-tools/cache/drivers/memory"
+	"github.com/olegshs/go-tools/cache/drivers/sqlite"
+	"github.com/olegshs/go-tools/cache/drivers/tiered"
+	cachestorage "github.com/olegshs/go-tools/cache/storage"
+	"github.com/olegshs/go-tools/events/bridge"
+	"github.com/olegshs/go-tools/router"
+)
+
+func newTestStorage() *ObjectStorage {
+	conf := memory.DefaultConfig()
+	conf.GC.Interval = 0
+
+	return &ObjectStorage{Storage: memory.NewStorage(conf)}
+}
+
+func newTestSqliteStorage(dir string) *sqlite.Storage {
+	conf := sqlite.DefaultConfig()
+	conf.File = filepath.Join(dir, "cache.db")
+	conf.GC.Interval = 0
+
+	return sqlite.NewStorage(conf)
+}
+
+func TestRemember(t *testing.T) {
+	storage := newTestStorage()
+
+	var calls int32
+	f := func() ([]string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []string{"a", "b"}, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			v, err := RememberIn(storage, "key", time.Minute, f)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(v) != 2 || v[1] != "b" {
+				t.Errorf(`unexpected value: %v`, v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf(`function called %d times, expected 1`, calls)
+	}
+
+	v, _ := RememberIn(storage, "key", time.Minute, f)
+	if calls != 1 || len(v) != 2 {
+		t.Errorf(`cached value was not used: %v, %d calls`, v, calls)
+	}
+
+	_, err := RememberIn(storage, "error", time.Minute, func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	if err == nil {
+		t.Error(`error expected`)
+	}
+
+	var n int
+	err = storage.GetOrSet("int", &n, time.Minute, func() (interface{}, error) {
+		return 42, nil
+	})
+	if err != nil || n != 42 {
+		t.Errorf(`GetOrSet() = %v, %d`, err, n)
+	}
+
+	storage.Forget("key")
+	RememberIn(storage, "key", time.Minute, f)
+	if calls != 2 {
+		t.Error(`value was not removed by Forget`)
+	}
+}
+
+func TestRemember_Shared(t *testing.T) {
+	var calls int32
+	f := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return 1, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RememberIn(ObjectStorageFor("remember_shared"), "key", time.Minute, f)
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf(`function called %d times, expected 1`, calls)
+	}
+}
+
+func TestRemember_Stale(t *testing.T) {
+	storage := newTestStorage()
+
+	var version int32
+	f := func() (int32, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}
+
+	ttl := 20 * time.Millisecond
+	stale := StaleWhileRevalidate(time.Minute)
+
+	RememberIn(storage, "key", ttl, f, stale)
+	time.Sleep(2 * ttl)
+
+	v, _ := RememberIn(storage, "key", ttl, f, stale)
+	if v != 1 {
+		t.Errorf(`stale value = %d, expected 1`, v)
+	}
+
+	time.Sleep(ttl / 2)
+
+	v, _ = RememberIn(storage, "key", ttl, f, stale)
+	if v != 2 {
+		t.Errorf(`value = %d after revalidation, expected 2`, v)
+	}
+}
+
+func TestTags(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileConf := file.DefaultConfig()
+	fileConf.Dir = dir
+
+	storages := map[string]*ObjectStorage{
+		"memory": newTestStorage(),
+		"file":   {Storage: file.NewStorage(fileConf)},
+		"sqlite": {Storage: newTestSqliteStorage(dir)},
+	}
+
+	for name, storage := range storages {
+		storage.SetTagged("post.1", "first", time.Minute, "posts", "user.1")
+		storage.SetTagged("post.2", "second", time.Minute, "posts", "user.2")
+		storage.Set("user.1", "user", time.Minute)
+
+		err := storage.InvalidateTags("user.1")
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		var s string
+		if storage.Get("post.1", &s) == nil {
+			t.Errorf(`%s: post.1 was not invalidated`, name)
+		}
+		if storage.Get("post.2", &s) != nil || s != "second" {
+			t.Errorf(`%s: post.2 was invalidated`, name)
+		}
+		if storage.Get("user.1", &s) != nil || s != "user" {
+			t.Errorf(`%s: untagged user.1 was invalidated`, name)
+		}
+
+		storage.SetTagged("post.3", "third", time.Minute, "posts")
+		version, err := storage.GetVersioned("post.3", &s)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		err = storage.CompareAndSwap("post.3", "swapped", version, time.Minute)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		// после сохранения без тегов элемент не связан с прежними тегами
+		storage.SetTagged("post.4", "fourth", time.Minute, "posts")
+		storage.Set("post.4", "untagged", time.Minute)
+
+		storage.InvalidateTags("posts")
+		if storage.Get("post.2", &s) == nil {
+			t.Errorf(`%s: post.2 was not invalidated`, name)
+		}
+		if storage.Get("post.3", &s) == nil {
+			t.Errorf(`%s: post.3 was not invalidated after CompareAndSwap`, name)
+		}
+		if storage.Get("post.4", &s) != nil || s != "untagged" {
+			t.Errorf(`%s: post.4 re-set without tags was invalidated`, name)
+		}
+	}
+
+	_, err = RememberIn(storages["memory"], "remember", time.Minute, func() (int, error) {
+		return 1, nil
+	}, WithTags("numbers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storages["memory"].InvalidateTags("numbers")
+	if _, err := storages["memory"].Storage.Get(rememberKey("remember")); err == nil {
+		t.Error(`remembered value was not invalidated`)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	storage := newTestStorage()
+
+	errs := storage.SetMulti(map[string]interface{}{
+		"a": "1",
+		"b": "2",
+	}, time.Minute)
+	if len(errs) != 0 {
+		t.Errorf(`SetMulti() errors: %v`, errs)
+	}
+
+	var a, b, c string
+	errs = storage.GetMulti(map[string]interface{}{
+		"a": &a,
+		"b": &b,
+		"c": &c,
+	})
+	if a != "1" || b != "2" {
+		t.Errorf(`GetMulti() = %q, %q`, a, b)
+	}
+	if len(errs) != 1 || !errors.Is(errs["c"], cachestorage.ErrNotFound) {
+		t.Errorf(`GetMulti() errors: %v, expected only "c" not found`, errs)
+	}
+
+	storage.DeleteMulti([]string{"a", "b"})
+	errs = storage.GetMulti(map[string]interface{}{"a": &a, "b": &b})
+	if len(errs) != 2 {
+		t.Errorf(`deleted objects are still available: %v`, errs)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileConf := file.DefaultConfig()
+	fileConf.Dir = dir
+
+	storages := map[string]*ObjectStorage{
+		"memory": newTestStorage(),
+		"file":   {Storage: file.NewStorage(fileConf)},
+		"sqlite": {Storage: newTestSqliteStorage(dir)},
+	}
+
+	for name, storage := range storages {
+		n, err := storage.Increment("views", 1, 10, time.Minute)
+		if err != nil || n != 11 {
+			t.Errorf(`%s: Increment() = %d, %v, expected 11`, name, n, err)
+		}
+		n, _ = storage.Decrement("views", 5, 10, time.Minute)
+		if n != 6 {
+			t.Errorf(`%s: Decrement() = %d, expected 6`, name, n)
+		}
+
+		if err := storage.Add("lock", "a", time.Minute); err != nil {
+			t.Errorf(`%s: Add() = %v`, name, err)
+		}
+		if err := storage.Add("lock", "b", time.Minute); err != cachestorage.ErrExists {
+			t.Errorf(`%s: Add() = %v for existing object, expected ErrExists`, name, err)
+		}
+
+		var s string
+		version, err := storage.GetVersioned("lock", &s)
+		if err != nil || s != "a" {
+			t.Fatalf(`%s: GetVersioned() = %q, %v`, name, s, err)
+		}
+		if err := storage.CompareAndSwap("lock", "c", version, time.Minute); err != nil {
+			t.Errorf(`%s: CompareAndSwap() = %v`, name, err)
+		}
+		if err := storage.CompareAndSwap("lock", "d", version, time.Minute); err != cachestorage.ErrVersionMismatch {
+			t.Errorf(`%s: CompareAndSwap() = %v for changed object, expected ErrVersionMismatch`, name, err)
+		}
+		if storage.Get("lock", &s); s != "c" {
+			t.Errorf(`%s: Get() = %q, expected "c"`, name, s)
+		}
+	}
+
+	storage := storages["memory"]
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			storage.Increment("counter", 1, 0, time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := storage.Increment("counter", 0, 0, time.Minute); n != 100 {
+		t.Errorf(`concurrent Increment() = %d, expected 100`, n)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	storage := newTestStorage()
+
+	storage.Set("legacy", []string{"gob"}, time.Minute)
+
+	storage.Encoder = codec.NewEncoder(codec.Config{Codec: codec.JSON})
+	storage.Set("json", []string{"json"}, time.Minute)
+
+	data, _ := storage.Storage.Get(objectStorageKey("json"))
+	if !strings.HasSuffix(string(data), `["json"]`) {
+		t.Errorf(`unexpected JSON data: %q`, data)
+	}
+
+	storage.Encoder = codec.NewEncoder(codec.Config{Codec: codec.Msgpack, Compression: codec.Gzip})
+
+	for key, expected := range map[string]string{"legacy": "gob", "json": "json"} {
+		var v []string
+		err := storage.Get(key, &v)
+		if err != nil || len(v) != 1 || v[0] != expected {
+			t.Errorf(`Get(%q) = %v, %v after codec change`, key, v, err)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	hmacKey := base64.StdEncoding.EncodeToString([]byte("hmac"))
+
+	inner := newTestStorage().Storage
+
+	old, err := NewEncryptedStorage(inner, cachestorage.ConfigEncryption{
+		Keys:    []string{oldKey},
+		HMACKey: hmacKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old.Set("token", []byte("secret"), time.Minute)
+
+	if _, err := inner.Get("token"); err == nil {
+		t.Error(`key was not replaced with HMAC`)
+	}
+	data, _ := inner.Get(old.key("token"))
+	if len(data) == 0 || bytes.Contains(data, []byte("secret")) {
+		t.Errorf(`value was not encrypted: %q`, data)
+	}
+
+	rotated, _ := NewEncryptedStorage(inner, cachestorage.ConfigEncryption{
+		Keys:    []string{newKey, oldKey},
+		HMACKey: hmacKey,
+	})
+	if data, err := rotated.Get("token"); err != nil || string(data) != "secret" {
+		t.Errorf(`Get() = %q, %v after key rotation`, data, err)
+	}
+
+	removed, _ := NewEncryptedStorage(inner, cachestorage.ConfigEncryption{
+		Keys:    []string{newKey},
+		HMACKey: hmacKey,
+	})
+	if _, err := removed.Get("token"); err != ErrDecrypt {
+		t.Errorf(`Get() = %v without old key, expected ErrDecrypt`, err)
+	}
+
+	// данные, перенесённые под другой ключ, не расшифровываются
+	inner.Set(old.key("other"), data, time.Minute)
+	if _, err := old.Get("other"); err != ErrDecrypt {
+		t.Errorf(`Get() = %v for moved value, expected ErrDecrypt`, err)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	l2 := memory.NewStorage(memory.DefaultConfig())
+	transport := bridge.NewMemoryTransport()
+
+	conf := tiered.DefaultConfig()
+	conf.L1.TTL = time.Minute
+
+	a := tiered.NewStorage(conf, l2, transport)
+	b := tiered.NewStorage(conf, l2, transport)
+	defer a.Close()
+	defer b.Close()
+
+	a.Set("key", []byte("1"), time.Minute)
+
+	data, err := b.Get("key")
+	if err != nil || string(data) != "1" {
+		t.Errorf(`Get() = %q, %v`, data, err)
+	}
+
+	// b хранит значение в памяти, изменение должно удалить его
+	a.Set("key", []byte("2"), time.Minute)
+
+	data, err = b.Get("key")
+	if err != nil || string(data) != "2" {
+		t.Errorf(`Get() = %q after update, expected "2"`, data)
+	}
+
+	a.Delete("key")
+	if _, err := b.Get("key"); err == nil {
+		t.Error(`deleted value is still available`)
+	}
+
+	// уровень без поддержки тегов
+	untagged := tiered.NewStorage(conf, struct{ tiered.Level }{l2}, nil)
+	defer untagged.Close()
+
+	if err := untagged.SetTagged("key", []byte("1"), time.Minute, "tag"); err != ErrTagsNotSupported {
+		t.Errorf(`SetTagged() = %v, expected ErrTagsNotSupported`, err)
+	}
+	if err := untagged.InvalidateTags("tag"); err != ErrTagsNotSupported {
+		t.Errorf(`InvalidateTags() = %v, expected ErrTagsNotSupported`, err)
+	}
+}
+
+func TestMemoryPolicies(t *testing.T) {
+	newStorage := func(policy string) *memory.Storage {
+		conf := memory.DefaultConfig()
+		conf.Size = 1
+		conf.Shards = 1
+		conf.Policy = policy
+		conf.GC.Interval = 0
+
+		return memory.NewStorage(conf)
+	}
+
+	// в хранилище размером 1 МБ помещается 10 элементов
+	data := make([]byte, 100*1024)
+	key := func(i int) string {
+		return fmt.Sprintf("item.%d", i)
+	}
+
+	stor := newStorage(memory.PolicyLRU)
+	for i := 0; i < 10; i++ {
+		stor.Set(key(i), data, time.Minute)
+	}
+	stor.Get(key(0))
+	stor.Set(key(10), data, time.Minute)
+	if _, err := stor.Get(key(0)); err != nil {
+		t.Error(`lru: recently used item was evicted`)
+	}
+	if _, err := stor.Get(key(1)); err == nil {
+		t.Error(`lru: least recently used item was not evicted`)
+	}
+	if stor.Evictions() != 1 {
+		t.Errorf(`lru: Evictions() = %d, expected 1`, stor.Evictions())
+	}
+
+	stor = newStorage(memory.PolicyLFU)
+	for i := 0; i < 10; i++ {
+		stor.Set(key(i), data, time.Minute)
+		if i != 5 {
+			stor.Get(key(i))
+		}
+	}
+	stor.Set(key(10), data, time.Minute)
+	if _, err := stor.Get(key(5)); err == nil {
+		t.Error(`lfu: least frequently used item was not evicted`)
+	}
+
+	stor = newStorage(memory.PolicyTinyLFU)
+	for i := 0; i < 10; i++ {
+		stor.Set(key(i), data, time.Minute)
+	}
+	for i := 0; i < 5; i++ {
+		stor.Get(key(0))
+	}
+	for i := 10; i < 100; i++ {
+		stor.Set(key(i), data, time.Minute)
+	}
+	if _, err := stor.Get(key(0)); err != nil {
+		t.Error(`tinylfu: frequently used item was evicted`)
+	}
+
+	stor = newStorage(memory.PolicyTTL)
+	for i := 0; i < 10; i++ {
+		stor.Set(key(i), data, time.Duration(20-i)*time.Minute)
+	}
+	stor.Set(key(10), data, time.Hour)
+	if _, err := stor.Get(key(9)); err == nil {
+		t.Error(`ttl: item with the shortest ttl was not evicted`)
+	}
+
+	// ограничение размера общее для всех сегментов
+	conf := memory.DefaultConfig()
+	conf.Size = 1
+	conf.GC.Interval = 0
+	stor = memory.NewStorage(conf)
+
+	big := make([]byte, 600*1024)
+	for i := 0; i < 3; i++ {
+		if err := stor.Set(key(i), big, time.Minute); err != nil {
+			t.Fatalf(`shards: Set() = %v for item smaller than the total size`, err)
+		}
+	}
+	if _, err := stor.Get(key(2)); err != nil {
+		t.Error(`shards: last item was evicted`)
+	}
+	if stor.Evictions() != 2 {
+		t.Errorf(`shards: Evictions() = %d, expected 2`, stor.Evictions())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetricsStorage(newTestStorage().Storage, `test"metrics`)
+
+	m.Set("a", make([]byte, 100), time.Minute)
+	m.Get("a")
+	m.Get("b")
+	m.GetMulti([]string{"a", "b"})
+
+	r := router.New()
+	r.Get("/metrics").Handle(MetricsHandler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf(`invalid content type: %s`, w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+
+	expected := []string{
+		`# TYPE cache_operations_total counter`,
+		`cache_operations_total{storage="test\"metrics",operation="get"} 2`,
+		`cache_operations_total{storage="test\"metrics",operation="get_multi"} 1`,
+		`cache_errors_total{storage="test\"metrics",operation="get"} 0`,
+		`cache_hits_total{storage="test\"metrics"} 2`,
+		`cache_misses_total{storage="test\"metrics"} 2`,
+		`cache_evictions_total{storage="test\"metrics"} 0`,
+		`cache_operation_duration_seconds_count{storage="test\"metrics",operation="set"} 1`,
+		`cache_payload_bytes_bucket{storage="test\"metrics",operation="set",le="64"} 0`,
+		`cache_payload_bytes_bucket{storage="test\"metrics",operation="set",le="256"} 1`,
+		`cache_payload_bytes_sum{storage="test\"metrics",operation="set"} 100`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf(`metrics do not contain %s`, line)
+		}
+	}
+
+	if strings.Contains(body, `operation="delete"`) {
+		t.Error(`metrics contain operation that was not called`)
+	}
+	if strings.Count(body, "# TYPE cache_hits_total") != 1 {
+		t.Error(`metric family is written more than once`)
+	}
+}
+
+type failingStorage struct {
+	StorageInterface
+}
+
+func (stor failingStorage) Get(key string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestMetrics_Errors(t *testing.T) {
+	m := NewMetricsStorage(failingStorage{newTestStorage().Storage}, "failing")
+
+	m.Get("a")
+
+	if m.misses != 0 {
+		t.Errorf(`transport error is counted as a miss: misses = %d`, m.misses)
+	}
+	if m.operations[OperationGet].errors != 1 {
+		t.Errorf(`errors = %d, expected 1`, m.operations[OperationGet].errors)
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := file.DefaultConfig()
+	conf.Dir = dir
+	conf.Depth = 2
+	conf.Size = 1
+	conf.GC.Interval = 300 * time.Millisecond
+	stor := file.NewStorage(conf)
+
+	short := []byte("short")
+	long := bytes.Repeat([]byte("long"), 100000)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if i%2 == 0 {
+				stor.Set("atomic", long, time.Minute)
+			} else {
+				stor.Set("atomic", short, time.Minute)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			data, err := stor.Get("atomic")
+			if err == nil && !bytes.Equal(data, short) && !bytes.Equal(data, long) {
+				t.Errorf(`Get() returned partially written data of %d bytes`, len(data))
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	stor.Delete("atomic")
+
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			if strings.Count(rel, string(filepath.Separator)) != 2 {
+				t.Errorf(`file %s is not in a subdirectory of depth 2`, rel)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	big := make([]byte, 600*1024)
+
+	stor.Set("a", big, time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	stor.Set("b", big, time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	stor.Get("a")
+
+	time.Sleep(500 * time.Millisecond)
+
+	if _, err := stor.Get("a"); err != nil {
+		t.Errorf(`recently read item was evicted: %v`, err)
+	}
+	if _, err := stor.Get("b"); err == nil {
+		t.Error(`least recently used item was not evicted`)
+	}
+	if stor.Evictions() != 1 {
+		t.Errorf(`Evictions() = %d, expected 1`, stor.Evictions())
+	}
+
+	tagFiles := func() map[string]string {
+		files, _ := filepath.Glob(filepath.Join(dir, "tags", "*.tag"))
+		m := map[string]string{}
+		for _, p := range files {
+			b, _ := os.ReadFile(p)
+			m[filepath.Base(p)] = string(b)
+		}
+		return m
+	}
+
+	for i := 0; i < 3; i++ {
+		stor.SetTagged("tagged.1", short, time.Minute, "t1", "t2")
+	}
+	stor.SetTagged("tagged.2", short, time.Minute, "t2")
+
+	for name, content := range tagFiles() {
+		if n := strings.Count(content, "\n"); n > 2 {
+			t.Errorf(`tag index %s has %d entries, expected no duplicates`, name, n)
+		}
+	}
+
+	stor.InvalidateTags("t1")
+
+	if files := tagFiles(); len(files) != 1 {
+		t.Errorf(`%d tag index files after InvalidateTags(), expected 1`, len(files))
+	} else {
+		for name, content := range files {
+			if strings.Count(content, "\n") != 1 {
+				t.Errorf(`tag index %s contains invalidated item: %q`, name, content)
+			}
+		}
+	}
+
+	stor.Delete("tagged.2")
+	time.Sleep(500 * time.Millisecond)
+
+	if files := tagFiles(); len(files) != 0 {
+		t.Errorf(`%d tag index files remain after the tagged items are deleted`, len(files))
+	}
+}
+
+func TestSqliteStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := sqlite.DefaultConfig()
+	conf.File = filepath.Join(dir, "cache.db")
+	conf.GC.Interval = 100 * time.Millisecond
+
+	stor := sqlite.NewStorage(conf)
+
+	stor.Set("persistent", []byte("value"), time.Hour)
+	stor.Set("expiring", []byte("value"), time.Second)
+	stor.Close()
+
+	stor = sqlite.NewStorage(conf)
+	defer stor.Close()
+
+	if data, err := stor.Get("persistent"); err != nil || string(data) != "value" {
+		t.Errorf(`Get() = %q, %v after reopening`, data, err)
+	}
+	if _, err := stor.Get("missing"); err != cachestorage.ErrNotFound {
+		t.Errorf(`Get() = %v for missing key, expected ErrNotFound`, err)
+	}
+	if stor.Hits() != 1 || stor.Misses() != 1 {
+		t.Errorf(`Hits() = %d, Misses() = %d, expected 1, 1`, stor.Hits(), stor.Misses())
+	}
+
+	items, errs := stor.GetMulti([]string{"persistent", "missing"})
+	if string(items["persistent"]) != "value" || errs["missing"] != cachestorage.ErrNotFound {
+		t.Errorf(`GetMulti() = %q, %v`, items, errs)
+	}
+
+	time.Sleep(2300 * time.Millisecond)
+
+	if _, err := stor.Get("expiring"); err != cachestorage.ErrNotFound {
+		t.Errorf(`Get() = %v, expired item was not removed`, err)
+	}
+}
@@ -0,0 +1,113 @@
+// Пакет codec реализует преобразование объектов кэша в байты и обратно.
+//
+// Кодеки и алгоритмы сжатия регистрируются под именем и однобайтовым идентификатором,
+// который записывается в заголовок данных. Поэтому данные, сохранённые до смены кодека
+// или сжатия, по-прежнему читаются, пока соответствующий кодек зарегистрирован.
+// Данные без заголовка считаются закодированными в gob.
+package codec
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Встроенные кодеки.
+const (
+	Gob     = "gob"
+	JSON    = "json"
+	Msgpack = "msgpack"
+)
+
+// Встроенные алгоритмы сжатия.
+const (
+	None = "none"
+	Gzip = "gzip"
+)
+
+// Codec преобразует значение в байты и обратно.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor сжимает и распаковывает данные.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+type registry[T any] struct {
+	byID   map[byte]T
+	byName map[string]byte
+	mutex  sync.RWMutex
+}
+
+var (
+	codecs      = newRegistry[Codec]()
+	compressors = newRegistry[Compressor]()
+)
+
+func init() {
+	Register(1, Gob, gobCodec{})
+	Register(2, JSON, jsonCodec{})
+	Register(3, Msgpack, msgpackCodec{})
+
+	RegisterCompressor(0, None, nil)
+	RegisterCompressor(1, Gzip, gzipCompressor{})
+}
+
+// Register регистрирует кодек. Идентификаторы до 16 зарезервированы для встроенных кодеков.
+// Идентификатор и имя не должны меняться, пока в кэше есть данные, сохранённые с ними.
+func Register(id byte, name string, c Codec) {
+	codecs.add(id, name, c)
+}
+
+// RegisterCompressor регистрирует алгоритм сжатия, например zstd.
+// Идентификаторы до 16 зарезервированы для встроенных алгоритмов.
+func RegisterCompressor(id byte, name string, c Compressor) {
+	compressors.add(id, name, c)
+}
+
+// ByName возвращает кодек по имени.
+func ByName(name string) (Codec, bool) {
+	_, c, ok := codecs.byNameGet(name)
+	return c, ok
+}
+
+func newRegistry[T any]() *registry[T] {
+	return &registry[T]{
+		byID:   map[byte]T{},
+		byName: map[string]byte{},
+	}
+}
+
+func (r *registry[T]) add(id byte, name string, v T) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.byID[id]; ok {
+		panic(fmt.Sprintf("codec id is already registered: %d", id))
+	}
+	if _, ok := r.byName[name]; ok {
+		panic("codec is already registered: " + name)
+	}
+
+	r.byID[id] = v
+	r.byName[name] = id
+}
+
+func (r *registry[T]) byIDGet(id byte) (T, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.byID[id]
+	return v, ok
+}
+
+func (r *registry[T]) byNameGet(name string) (byte, T, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	id, ok := r.byName[name]
+	return id, r.byID[id], ok
+}
@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TestBase struct {
+	ID int64 `json:"id"`
+}
+
+type testPost struct {
+	TestBase
+	Title    string            `json:"title"`
+	Tags     []string          `json:"tags"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Rating   float64           `json:"rating"`
+	Data     []byte            `json:"data"`
+	Created  time.Time         `json:"created"`
+	Author   *string           `json:"author"`
+	Internal string            `json:"-"`
+}
+
+func newTestPost() testPost {
+	author := "author"
+
+	return testPost{
+		TestBase: TestBase{ID: -100000},
+		Title:    strings.Repeat("title", 100),
+		Tags:     []string{"a", "b"},
+		Rating:   4.5,
+		Data:     []byte{0, 1, 2},
+		Created:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Author:   &author,
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	post := newTestPost()
+
+	for _, name := range []string{Gob, JSON, Msgpack} {
+		for _, compression := range []string{None, Gzip} {
+			enc := NewEncoder(Config{Codec: name, Compression: compression, Threshold: 100})
+
+			data, err := enc.Encode(post)
+			if err != nil {
+				t.Fatal(name, compression, err)
+			}
+
+			var decoded testPost
+			err = Decode(data, &decoded)
+			if err != nil {
+				t.Fatal(name, compression, err)
+			}
+
+			if !reflect.DeepEqual(decoded, post) {
+				t.Errorf(`%s/%s: decoded %+v, expected %+v`, name, compression, decoded, post)
+			}
+		}
+	}
+}
+
+func TestEncoder_Threshold(t *testing.T) {
+	enc := NewEncoder(Config{Codec: JSON, Compression: Gzip, Threshold: 100})
+
+	data, _ := enc.Encode("short")
+	if data[3] != 0 || string(data[headerSize:]) != `"short"` {
+		t.Errorf(`short value was compressed: %q`, data)
+	}
+
+	data, _ = enc.Encode(strings.Repeat("long", 100))
+	if data[3] == 0 {
+		t.Error(`long value was not compressed`)
+	}
+}
+
+func TestDecode_Legacy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gob.NewEncoder(buf).Encode([]int{1, 2, 3})
+
+	var v []int
+	err := Decode(buf.Bytes(), &v)
+	if err != nil || len(v) != 3 {
+		t.Errorf(`Decode() = %v, %v for data without header`, v, err)
+	}
+
+	data, _ := NewEncoder(DefaultConfig()).Encode([]int{1, 2, 3})
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Error(`default encoder added a header`)
+	}
+
+	err = Decode([]byte{headerMarker, headerVersion, 200, 0}, &v)
+	if err != ErrUnknownCodec {
+		t.Errorf(`Decode() = %v, expected ErrUnknownCodec`, err)
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	c := msgpackCodec{}
+
+	// https://github.com/msgpack/msgpack/blob/master/spec.md
+	tests := []struct {
+		value interface{}
+		data  []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{1, []byte{0x01}},
+		{-1, []byte{0xff}},
+		{200, []byte{0xcc, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{"abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]int{"a": 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+	}
+
+	for _, test := range tests {
+		data, err := c.Marshal(test.value)
+		if err != nil || !bytes.Equal(data, test.data) {
+			t.Errorf(`Marshal(%v) = % x, %v, expected % x`, test.value, data, err, test.data)
+		}
+	}
+
+	var v interface{}
+	c.Unmarshal([]byte{0x82, 0xa1, 'a', 0x92, 0x01, 0xc3, 0xa1, 'b', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, &v)
+
+	expected := map[string]interface{}{"a": []interface{}{int64(1), true}, "b": 1.5}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf(`Unmarshal() = %v, expected %v`, v, expected)
+	}
+
+	var n int8
+	if err := c.Unmarshal([]byte{0xcc, 0xc8}, &n); err == nil {
+		t.Error(`Unmarshal() did not detect overflow`)
+	}
+	if err := c.Unmarshal([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &v); err == nil {
+		t.Error(`Unmarshal() did not detect truncated data`)
+	}
+}
@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnknownCodec      = errors.New("unknown codec")
+	ErrUnknownCompressor = errors.New("unknown compressor")
+	ErrInvalidHeader     = errors.New("invalid codec header")
+)
+
+// Заголовок данных: нулевой байт, который не может быть первым байтом данных gob,
+// версия формата заголовка, идентификаторы кодека и алгоритма сжатия.
+const (
+	headerMarker  = 0x00
+	headerVersion = 1
+	headerSize    = 4
+)
+
+type Config struct {
+	Codec       string `json:"codec"`       // имя кодека, например JSON; по умолчанию gob без заголовка
+	Compression string `json:"compression"` // имя алгоритма сжатия, например Gzip
+	Threshold   int    `json:"threshold"`   // минимальный размер данных в байтах для сжатия
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Codec:       "",
+		Compression: None,
+		Threshold:   1024,
+	}
+}
+
+// Encoder кодирует значения выбранным кодеком и сжимает данные, размер которых
+// не меньше порогового. Данные декодируются по заголовку независимо от настроек.
+// Если кодек не указан, то значения кодируются в gob без заголовка и сжатия,
+// как в прежних версиях, поэтому их могут прочитать приложения без поддержки заголовка.
+type Encoder struct {
+	codecID byte
+	codec   Codec
+
+	compressorID byte
+	compressor   Compressor
+	threshold    int
+}
+
+func NewEncoder(conf Config) *Encoder {
+	enc := new(Encoder)
+
+	if conf.Codec == "" {
+		return enc
+	}
+
+	var ok bool
+
+	enc.codecID, enc.codec, ok = codecs.byNameGet(conf.Codec)
+	if !ok {
+		panic("invalid cache codec: " + conf.Codec)
+	}
+
+	compression := conf.Compression
+	if compression == "" {
+		compression = None
+	}
+
+	enc.compressorID, enc.compressor, ok = compressors.byNameGet(compression)
+	if !ok {
+		panic("invalid cache compression: " + conf.Compression)
+	}
+
+	enc.threshold = conf.Threshold
+
+	return enc
+}
+
+// Encode кодирует значение и добавляет заголовок.
+func (enc *Encoder) Encode(v interface{}) ([]byte, error) {
+	if enc.codec == nil {
+		return gobCodec{}.Marshal(v)
+	}
+
+	payload, err := enc.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	compressorID := byte(0)
+	if enc.compressor != nil && len(payload) >= enc.threshold {
+		payload, err = enc.compressor.Compress(payload)
+		if err != nil {
+			return nil, err
+		}
+		compressorID = enc.compressorID
+	}
+
+	data := make([]byte, headerSize, headerSize+len(payload))
+	data[0] = headerMarker
+	data[1] = headerVersion
+	data[2] = enc.codecID
+	data[3] = compressorID
+
+	return append(data, payload...), nil
+}
+
+// Decode декодирует данные в значение v, см. Decode.
+func (enc *Encoder) Decode(data []byte, v interface{}) error {
+	return Decode(data, v)
+}
+
+// Decode декодирует данные в значение v кодеком, указанным в заголовке.
+// Данные без заголовка декодируются кодеком gob.
+func Decode(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != headerMarker {
+		return gobCodec{}.Unmarshal(data, v)
+	}
+
+	if len(data) < headerSize || data[1] != headerVersion {
+		return ErrInvalidHeader
+	}
+
+	c, ok := codecs.byIDGet(data[2])
+	if !ok {
+		return ErrUnknownCodec
+	}
+
+	payload := data[headerSize:]
+
+	if data[3] != 0 {
+		compressor, ok := compressors.byIDGet(data[3])
+		if !ok || compressor == nil {
+			return ErrUnknownCompressor
+		}
+
+		var err error
+		payload, err = compressor.Decompress(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Unmarshal(payload, v)
+}
@@ -0,0 +1,791 @@
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	errMsgpackTruncated = errors.New("msgpack: unexpected end of data")
+)
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// msgpackCodec кодирует значения в формат MessagePack, https://msgpack.org.
+// Структуры кодируются как словари с именами полей с учётом тегов json,
+// значения с методом MarshalBinary, например time.Time, — как двоичные данные.
+// Расширения формата не поддерживаются.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	e := new(msgpackEncoder)
+
+	err := e.encode(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: invalid target %T", v)
+	}
+
+	d := &msgpackDecoder{data: data}
+
+	return d.decode(rv.Elem())
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+	}
+
+	if v.Type().Implements(binaryMarshalerType) {
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.writeBin(b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+
+	case reflect.String:
+		e.writeString(v.String())
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.writeBin(b)
+			return nil
+		}
+
+		n := v.Len()
+		e.writeHeader(n, 0x90, 0xdc, 0xdd)
+		for i := 0; i < n; i++ {
+			err := e.encode(v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		e.writeHeader(v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			err := e.encode(iter.Key())
+			if err != nil {
+				return err
+			}
+			err = e.encode(iter.Value())
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		fields := structFields(v.Type())
+
+		values := make([]reflect.Value, len(fields))
+		n := 0
+		for i, f := range fields {
+			fv := v.FieldByIndex(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			values[i] = fv
+			n++
+		}
+
+		e.writeHeader(n, 0x80, 0xde, 0xdf)
+		for i, f := range fields {
+			if !values[i].IsValid() {
+				continue
+			}
+			e.writeString(f.name)
+			err := e.encode(values[i])
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Ptr, reflect.Interface:
+		return e.encode(v.Elem())
+
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (e *msgpackEncoder) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.writeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) writeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) writeBin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// writeHeader записывает заголовок массива или словаря: короткий формат fix
+// для n < 16, затем форматы с 16- и 32-битной длиной.
+func (e *msgpackEncoder) writeHeader(n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, b16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, b32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	if d.pos >= len(d.data) {
+		return errMsgpackTruncated
+	}
+
+	if d.data[d.pos] == 0xc0 {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(binaryUnmarshalerType) {
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+		}
+
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+
+	case reflect.Bool:
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		b, ok := x.(bool)
+		if !ok {
+			return typeError(x, v)
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		n, ok := x.(int64)
+		if !ok || v.OverflowInt(n) {
+			return typeError(x, v)
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		var n uint64
+		switch t := x.(type) {
+		case int64:
+			if t < 0 {
+				return typeError(x, v)
+			}
+			n = uint64(t)
+		case uint64:
+			n = t
+		default:
+			return typeError(x, v)
+		}
+		if v.OverflowUint(n) {
+			return typeError(x, v)
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		switch t := x.(type) {
+		case float64:
+			v.SetFloat(t)
+		case int64:
+			v.SetFloat(float64(t))
+		case uint64:
+			v.SetFloat(float64(t))
+		default:
+			return typeError(x, v)
+		}
+
+	case reflect.String:
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+
+		n, err := d.readLength(0x90, 0xdc, 0xdd)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			err := d.decode(s.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+
+		n, err := d.readLength(0x90, 0xdc, 0xdd)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				_, err := d.decodeAny()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := d.decode(v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		n, err := d.readLength(0x80, 0xde, 0xdf)
+		if err != nil {
+			return err
+		}
+		t := v.Type()
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, n))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			err := d.decode(key)
+			if err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			err = d.decode(value)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+
+	case reflect.Struct:
+		n, err := d.readLength(0x80, 0xde, 0xdf)
+		if err != nil {
+			return err
+		}
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			name, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+
+			f := findField(fields, string(name))
+			if f == nil {
+				_, err := d.decodeAny()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err = d.decode(v.FieldByIndex(f.index))
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// decodeAny декодирует значение в типы bool, int64, uint64 (только значения больше MaxInt64),
+// float64, string, []byte, []interface{}, map[string]interface{} или map[interface{}]interface{}.
+func (d *msgpackDecoder) decodeAny() (interface{}, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		b, err := d.read(int(c & 0x1f))
+		return string(b), err
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n))
+		return append([]byte{}, b...), err
+
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+
+	case 0xd0:
+		n, err := d.readUint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.readUint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.readUint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.readUint(8)
+		return int64(n), err
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n))
+		return string(b), err
+
+	case 0xdc, 0xdd:
+		n, err := d.readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n))
+
+	case 0xde, 0xdf:
+		n, err := d.readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n))
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", c)
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+
+	a := make([]interface{}, n)
+	for i := range a {
+		var err error
+		a[i], err = d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+
+	keys := make([]interface{}, n)
+	values := make([]interface{}, n)
+	stringKeys := true
+
+	for i := 0; i < n; i++ {
+		var err error
+		keys[i], err = d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		values[i], err = d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := keys[i].(string); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]interface{}, n)
+		for i, key := range keys {
+			m[key.(string)] = values[i]
+		}
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, n)
+	for i, key := range keys {
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("msgpack: unsupported map key type %T", key)
+		}
+		m[key] = values[i]
+	}
+
+	return m, nil
+}
+
+// readBytes читает строку или двоичные данные.
+func (d *msgpackDecoder) readBytes() ([]byte, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n uint64
+
+	switch {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c >= 0xc4 && c <= 0xc6:
+		n, err = d.readUint(1 << (c - 0xc4))
+	case c >= 0xd9 && c <= 0xdb:
+		n, err = d.readUint(1 << (c - 0xd9))
+	default:
+		return nil, fmt.Errorf("msgpack: expected string or binary, got format 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.read(int(n))
+}
+
+// readLength читает длину массива или словаря, см. msgpackEncoder.writeHeader.
+func (d *msgpackDecoder) readLength(fix, b16, b32 byte) (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+
+	switch c {
+	case b16:
+		n, err = d.readUint(2)
+	case b32:
+		n, err = d.readUint(4)
+	default:
+		if c&0xf0 != fix {
+			return 0, fmt.Errorf("msgpack: unexpected format 0x%02x", c)
+		}
+		n = uint64(c & 0x0f)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// каждый элемент занимает хотя бы один байт
+	if n > uint64(len(d.data)-d.pos) {
+		return 0, errMsgpackTruncated
+	}
+
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errMsgpackTruncated
+	}
+
+	c := d.data[d.pos]
+	d.pos++
+
+	return c, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+
+	return n, nil
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+func typeError(x interface{}, v reflect.Value) error {
+	return fmt.Errorf("msgpack: cannot decode %T into %s", x, v.Type())
+}
+
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var msgpackFields sync.Map
+
+// structFields возвращает кодируемые поля структуры. Имена полей берутся из тегов json,
+// поля встроенных структур без тега кодируются как поля внешней структуры.
+func structFields(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFields.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+
+	fields := []msgpackField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range structFields(f.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     f.Index,
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+
+	msgpackFields.Store(t, fields)
+
+	return fields
+}
+
+func findField(fields []msgpackField, name string) *msgpackField {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+
+	return nil
+}
@@ -26,10 +26,51 @@ func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
 	return nil
 }
 
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return initial + delta, nil
+}
+
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return initial - delta, nil
+}
+
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	atomic.AddInt64(&stor.misses, 1)
+	return nil, nil, storage.ErrNotFound
+}
+
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	return storage.ErrNotFound
+}
+
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	return storage.GetMulti(keys, stor.Get)
+}
+
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	return map[string]error{}
+}
+
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	return nil
+}
+
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	return nil
+}
+
 func (stor *Storage) Delete(key string) error {
 	return storage.ErrNotFound
 }
 
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	return storage.DeleteMulti(keys, stor.Delete)
+}
+
 func (stor *Storage) DeleteAll() error {
 	return nil
 }
@@ -0,0 +1,15 @@
+package file
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime возвращает время последнего доступа к файлу.
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime возвращает время последнего изменения файла:
+// время доступа на этой платформе недоступно.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -8,9 +8,13 @@ import (
 
 type Config struct {
 	storage.Config
-	Dir  string   `json:"dir"`
-	Hash string   `json:"hash"`
-	GC   ConfigGC `json:"gc"`
+	Dir      string   `json:"dir"`
+	Hash     string   `json:"hash"`
+	Depth    int      `json:"depth"`     // количество уровней подкаталогов по первым байтам хеша ключа
+	Size     int64    `json:"size"`      // максимальный размер в мегабайтах, 0 — без ограничения; проверяется при сборке мусора
+	Fsync    bool     `json:"fsync"`     // сбрасывать данные файла на диск перед заменой элемента
+	FsyncDir bool     `json:"fsync_dir"` // сбрасывать на диск каталог после замены элемента
+	GC       ConfigGC `json:"gc"`
 }
 
 type ConfigGC struct {
@@ -19,9 +23,13 @@ type ConfigGC struct {
 
 func DefaultConfig() Config {
 	return Config{
-		Config: storage.DefaultConfig(),
-		Dir:    "tmp/cache",
-		Hash:   "md5",
+		Config:   storage.DefaultConfig(),
+		Dir:      "tmp/cache",
+		Hash:     "md5",
+		Depth:    1,
+		Size:     0,
+		Fsync:    false,
+		FsyncDir: false,
 		GC: ConfigGC{
 			Interval: 0,
 		},
@@ -2,14 +2,20 @@
 package file
 
 import (
+	"crypto"
 	_ "crypto/md5"
 	"encoding/binary"
 	"fmt"
-	"hash"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,19 +26,46 @@ import (
 
 const (
 	fileExtension = ".tmp"
+	tagExtension  = ".tag"
+	tagDir        = "tags"
+
+	// временные файлы, из которых данные переносятся в файл элемента
+	tempExtension = ".new"
+	tempMaxAge    = time.Hour
+
+	// флаг во времени устаревания, которое записано в начале файла элемента:
+	// после времени устаревания записаны теги элемента
+	flagTagged = 1 << 62
 )
 
+// Storage хранит каждый элемент в отдельном файле. Данные записываются во временный файл,
+// который затем переименовывается в файл элемента, поэтому при одновременном чтении
+// не могут быть прочитаны частично записанные данные.
+//
+// Если задан максимальный размер, то при сборке мусора удаляются файлы,
+// к которым дольше всего не было доступа.
 type Storage struct {
-	dir  string
-	hash hash.Hash
+	dir   string
+	hash  crypto.Hash
+	depth int
+
+	size     int64
+	fsync    bool
+	fsyncDir bool
+
+	// блокировка записи, обеспечивает атомарность Add, Increment и CompareAndSwap
+	mutex sync.Mutex
+	// блокировка индексных файлов тегов
+	tagMutex sync.Mutex
 
 	ttlDefault time.Duration
 	ttlMax     time.Duration
 
 	gc *helpers.Interval
 
-	hits   int64
-	misses int64
+	hits      int64
+	misses    int64
+	evictions int64
 }
 
 func NewStorage(conf Config) *Storage {
@@ -44,7 +77,16 @@ func NewStorage(conf Config) *Storage {
 	if !h.Available() {
 		panic("hash function is not available: " + conf.Hash)
 	}
-	stor.hash = h.New()
+	stor.hash = h
+
+	if conf.Depth < 0 || conf.Depth >= h.Size() {
+		panic("invalid cache directory depth: " + strconv.Itoa(conf.Depth))
+	}
+	stor.depth = conf.Depth
+
+	stor.size = conf.Size * 1024 * 1024
+	stor.fsync = conf.Fsync
+	stor.fsyncDir = conf.FsyncDir
 
 	stor.ttlDefault = conf.TTL.Default
 	stor.ttlMax = conf.TTL.Maximum
@@ -60,75 +102,332 @@ func NewStorage(conf Config) *Storage {
 func (stor *Storage) Get(key string) ([]byte, error) {
 	p := stor.pathByKey(key)
 
-	f, err := os.Open(p)
+	_, data, err := stor.read(p)
 	if err != nil {
 		atomic.AddInt64(&stor.misses, 1)
-
-		if os.IsNotExist(err) {
-			return nil, storage.ErrNotFound
-		}
 		return nil, err
 	}
-	defer f.Close()
 
-	var exp int64
+	atomic.AddInt64(&stor.hits, 1)
+	return data, nil
+}
+
+func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
+	p := stor.pathByKey(key)
+	exp := storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
+
+	return stor.write(p, exp, data)
+}
+
+// Add сохраняет данные, только если элемент отсутствует, иначе возвращает storage.ErrExists.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	p := stor.pathByKey(key)
+	exp := storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
 
-	err = binary.Read(f, binary.LittleEndian, &exp)
+	_, _, err := stor.read(p)
+	if err == nil {
+		return storage.ErrExists
+	}
+	if err != storage.ErrNotFound && err != storage.ErrExpired {
+		return err
+	}
+
+	return stor.write(p, exp, data)
+}
+
+// Increment увеличивает числовое значение элемента на delta и возвращает результат.
+// Отсутствующий элемент создаётся со значением initial + delta и временем хранения ttl,
+// время устаревания существующего элемента не изменяется.
+// Атомарность обеспечивается только в пределах одного процесса.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	p := stor.pathByKey(key)
+
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
+
+	exp, tags, data, err := stor.readItem(p)
+	if err == storage.ErrNotFound || err == storage.ErrExpired {
+		n := initial + delta
+		exp := storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+		return n, stor.write(p, exp, strconv.AppendInt(nil, n, 10))
+	}
 	if err != nil {
-		atomic.AddInt64(&stor.misses, 1)
-		return nil, err
+		return 0, err
 	}
 
-	if exp > 0 && time.Unix(exp, 0).Before(time.Now()) {
-		atomic.AddInt64(&stor.misses, 1)
-		return nil, storage.ErrExpired
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, storage.ErrInvalidData
 	}
+	n += delta
 
-	data, err := ioutil.ReadAll(f)
+	return n, stor.writeItem(p, exp, tags, strconv.AppendInt(nil, n, 10))
+}
+
+// Decrement уменьшает числовое значение элемента на delta, см. Increment.
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return stor.Increment(key, -delta, initial, ttl)
+}
+
+// GetVersioned возвращает данные и версию элемента для CompareAndSwap.
+// Версией служит контрольная сумма содержимого файла.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	p := stor.pathByKey(key)
+
+	exp, data, err := stor.read(p)
 	if err != nil {
 		atomic.AddInt64(&stor.misses, 1)
-		return nil, err
+		return nil, nil, err
 	}
 
 	atomic.AddInt64(&stor.hits, 1)
-	return data, nil
+	return data, version(exp, data), nil
 }
 
-func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
+// CompareAndSwap сохраняет данные, только если содержимое файла не изменилось после чтения
+// с помощью GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+// Атомарность обеспечивается только в пределах одного процесса.
+func (stor *Storage) CompareAndSwap(key string, data []byte, v storage.Version, ttl time.Duration) error {
 	p := stor.pathByKey(key)
 
-	d := path.Dir(p)
-	if _, err := os.Stat(d); err != nil {
-		err = os.MkdirAll(d, 0700)
-		if err != nil {
-			return err
-		}
-	}
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
 
-	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	exp, tags, current, err := stor.readItem(p)
+	if err == storage.ErrExpired {
+		return storage.ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
+	if v != version(exp, current) {
+		return storage.ErrVersionMismatch
+	}
+
+	exp = storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+
+	// теги сохраняются, чтобы элемент оставался связан с ними
+	return stor.writeItem(p, exp, tags, data)
+}
+
+// GetMulti читает данные по нескольким ключам. Возвращает найденные данные и ошибки по ключам.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	return storage.GetMulti(keys, stor.Get)
+}
+
+// SetMulti сохраняет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	return storage.SetMulti(items, func(key string, data []byte) error {
+		return stor.Set(key, data, ttl)
+	})
+}
+
+// SetTagged сохраняет данные с тегами, см. InvalidateTags. Теги записываются в файл элемента,
+// а путь к файлу добавляется в индексный файл каждого тега, если его там ещё нет.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	item := stor.pathByKey(key)
 	exp := storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
 
-	err = binary.Write(f, binary.LittleEndian, exp)
+	stor.mutex.Lock()
+	err := stor.writeItem(item, exp, tags, data)
+	stor.mutex.Unlock()
 	if err != nil {
 		return err
 	}
 
-	_, err = f.Write(data)
+	line := []byte(item + "\n")
+
+	stor.tagMutex.Lock()
+	defer stor.tagMutex.Unlock()
+
+	for _, tag := range tags {
+		p := stor.pathByTag(tag)
+
+		paths, err := readTag(p)
+		if err != nil {
+			return err
+		}
+		if contains(paths, item) {
+			continue
+		}
+
+		err = os.MkdirAll(path.Dir(p), 0700)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Write(line)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InvalidateTags удаляет все файлы, сохранённые с любым из указанных тегов.
+// Файлы, которые после сохранения с тегом были перезаписаны без него, не удаляются.
+// Пути к удалённым файлам исключаются из индексных файлов остальных тегов.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	stor.tagMutex.Lock()
+	defer stor.tagMutex.Unlock()
+
+	removed := map[string]bool{}
+
+	for _, tag := range tags {
+		p := stor.pathByTag(tag)
+
+		paths, err := readTag(p)
+		if err != nil {
+			return err
+		}
+		if paths == nil {
+			continue
+		}
+
+		err = os.Remove(p)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range paths {
+			ok, err := stor.removeTagged(item, tag)
+			if err != nil {
+				return err
+			}
+			if ok {
+				removed[item] = true
+			}
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	return stor.pruneTags(func(item string) bool {
+		return !removed[item]
+	})
+}
+
+// removeTagged удаляет файл элемента, если он сохранён с указанным тегом.
+func (stor *Storage) removeTagged(p string, tag string) (bool, error) {
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	_, tags, err := readHeader(f)
+	f.Close()
+	if err != nil || !contains(tags, tag) {
+		return false, nil
+	}
+
+	err = os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// pruneTags перезаписывает индексные файлы тегов, оставляя в них только пути,
+// для которых keep возвращает true. Пустые индексные файлы удаляются.
+// Вызывается под блокировкой tagMutex.
+func (stor *Storage) pruneTags(keep func(item string) bool) error {
+	files, err := filepath.Glob(filepath.Join(stor.dir, tagDir, "*"+tagExtension))
 	if err != nil {
 		return err
 	}
 
+	for _, p := range files {
+		paths, err := readTag(p)
+		if err != nil {
+			return err
+		}
+
+		a := paths[:0]
+		for _, item := range paths {
+			if keep(item) {
+				a = append(a, item)
+			}
+		}
+
+		switch {
+		case len(a) == len(paths):
+			continue
+		case len(a) == 0:
+			err = os.Remove(p)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		default:
+			err = stor.replace(p, []byte(strings.Join(a, "\n")+"\n"))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// readTag возвращает пути к файлам из индексного файла тега
+// или nil, если индексного файла нет.
+func readTag(p string) ([]string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" && !contains(paths, line) {
+			paths = append(paths, line)
+		}
+	}
+
+	return paths, nil
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (stor *Storage) Delete(key string) error {
 	p := stor.pathByKey(key)
 
+	stor.mutex.Lock()
+	defer stor.mutex.Unlock()
+
 	err := os.Remove(p)
 	if err != nil {
 		return err
@@ -137,6 +436,11 @@ func (stor *Storage) Delete(key string) error {
 	return nil
 }
 
+// DeleteMulti удаляет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	return storage.DeleteMulti(keys, stor.Delete)
+}
+
 func (stor *Storage) DeleteAll() error {
 	err := filepath.Walk(stor.dir, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -147,7 +451,8 @@ func (stor *Storage) DeleteAll() error {
 			return nil
 		}
 
-		if p[len(p)-len(fileExtension):] != fileExtension {
+		ext := filepath.Ext(p)
+		if ext != fileExtension && ext != tagExtension {
 			return nil
 		}
 
@@ -173,49 +478,330 @@ func (stor *Storage) Misses() int64 {
 	return stor.misses
 }
 
-func (stor *Storage) gcRun() {
-	filepath.Walk(stor.dir, func(p string, info os.FileInfo, err error) error {
+// Evictions возвращает количество файлов, удалённых из-за ограничения размера.
+func (stor *Storage) Evictions() int64 {
+	return atomic.LoadInt64(&stor.evictions)
+}
+
+// read читает время устаревания и данные из файла элемента.
+func (stor *Storage) read(p string) (int64, []byte, error) {
+	exp, _, data, err := stor.readItem(p)
+	return exp, data, err
+}
+
+// readItem читает время устаревания, теги и данные элемента.
+func (stor *Storage) readItem(p string) (int64, []string, []byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, nil, storage.ErrNotFound
+		}
+		return 0, nil, nil, err
+	}
+	defer f.Close()
+
+	exp, tags, err := readHeader(f)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if exp > 0 && time.Unix(exp, 0).Before(time.Now()) {
+		return 0, nil, nil, storage.ErrExpired
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if stor.size > 0 {
+		stor.touch(p, f)
+	}
+
+	return exp, tags, data, nil
+}
+
+// readHeader читает из начала файла элемента время устаревания и теги.
+// Формат: время устаревания (int64), если установлен флаг flagTagged —
+// количество тегов (uint16) и для каждого тега длина (uint16) и название, затем данные.
+func readHeader(r io.Reader) (int64, []string, error) {
+	var exp int64
+
+	err := binary.Read(r, binary.LittleEndian, &exp)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if exp&flagTagged == 0 {
+		return exp, nil, nil
+	}
+
+	var n uint16
+
+	err = binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tags := make([]string, n)
+	for i := range tags {
+		var l uint16
+
+		err = binary.Read(r, binary.LittleEndian, &l)
 		if err != nil {
-			return nil
+			return 0, nil, err
 		}
 
-		if info.IsDir() {
-			return nil
+		b := make([]byte, l)
+
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return 0, nil, err
 		}
 
-		if p[len(p)-len(fileExtension):] != fileExtension {
-			return nil
+		tags[i] = string(b)
+	}
+
+	return exp &^ flagTagged, tags, nil
+}
+
+// touch обновляет время доступа к файлу, если оно не позже времени изменения
+// или устарело более чем на минуту. Время доступа используется при вытеснении
+// и не обновляется системой, если файловая система смонтирована с noatime.
+func (stor *Storage) touch(p string, f *os.File) {
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	atime := accessTime(info)
+
+	if atime.After(info.ModTime()) && now.Sub(atime) < time.Minute {
+		return
+	}
+
+	os.Chtimes(p, now, info.ModTime())
+}
+
+// write записывает время устаревания и данные во временный файл и заменяет им файл элемента.
+func (stor *Storage) write(p string, exp int64, data []byte) error {
+	return stor.writeItem(p, exp, nil, data)
+}
+
+// writeItem записывает файл элемента с тегами, см. readHeader.
+func (stor *Storage) writeItem(p string, exp int64, tags []string, data []byte) error {
+	size := 8 + len(data)
+	if len(tags) > 0 {
+		exp |= flagTagged
+		size += 2
+		for _, tag := range tags {
+			size += 2 + len(tag)
 		}
+	}
+
+	b := make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint64(b, uint64(exp))
+	if len(tags) > 0 {
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(tags)))
+		for _, tag := range tags {
+			b = binary.LittleEndian.AppendUint16(b, uint16(len(tag)))
+			b = append(b, tag...)
+		}
+	}
+	b = append(b, data...)
 
-		f, err := os.Open(p)
+	return stor.replace(p, b)
+}
+
+// replace записывает данные во временный файл и заменяет им файл p.
+func (stor *Storage) replace(p string, b []byte) error {
+	d := path.Dir(p)
+	if _, err := os.Stat(d); err != nil {
+		err = os.MkdirAll(d, 0700)
 		if err != nil {
-			return nil
+			return err
 		}
-		defer f.Close()
+	}
+
+	f, err := os.CreateTemp(d, path.Base(p)+".*"+tempExtension)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(b)
+	if err == nil && stor.fsync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, p)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if stor.fsyncDir {
+		return syncDir(d)
+	}
+
+	return nil
+}
+
+func syncDir(d string) error {
+	f, err := os.Open(d)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-		var exp int64
+	return f.Sync()
+}
 
-		err = binary.Read(f, binary.LittleEndian, &exp)
+// gcRun удаляет устаревшие файлы и оставшиеся после сбоев временные файлы,
+// а если превышен максимальный размер, то файлы, к которым дольше всего не было доступа.
+// Индексные файлы тегов учитываются в размере; пути к удалённым файлам исключаются из них.
+func (stor *Storage) gcRun() {
+	defer func() {
+		stor.tagMutex.Lock()
+		defer stor.tagMutex.Unlock()
+
+		stor.pruneTags(func(item string) bool {
+			_, err := os.Stat(item)
+			return err == nil
+		})
+	}()
+
+	type entry struct {
+		path  string
+		size  int64
+		atime time.Time
+	}
+
+	var (
+		entries []entry
+		total   int64
+	)
+
+	now := time.Now()
+
+	filepath.Walk(stor.dir, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
 
-		if exp <= 0 {
+		if info.IsDir() {
+			return nil
+		}
+
+		switch filepath.Ext(p) {
+		case fileExtension:
+		case tagExtension:
+			if stor.size > 0 {
+				total += info.Size()
+			}
+			return nil
+		case tempExtension:
+			if now.Sub(info.ModTime()) > tempMaxAge {
+				os.Remove(p)
+			}
+			return nil
+		default:
 			return nil
 		}
 
-		if time.Unix(exp, 0).Before(time.Now()) {
+		if stor.expired(p) {
 			os.Remove(p)
+			return nil
+		}
+
+		if stor.size > 0 {
+			entries = append(entries, entry{p, info.Size(), accessTime(info)})
+			total += info.Size()
 		}
 
 		return nil
 	})
+
+	if total <= stor.size {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].atime.Before(entries[j].atime)
+	})
+
+	for _, e := range entries {
+		if total <= stor.size {
+			break
+		}
+
+		err := os.Remove(e.path)
+		if err != nil {
+			continue
+		}
+
+		total -= e.size
+		atomic.AddInt64(&stor.evictions, 1)
+	}
+}
+
+// expired проверяет, устарел ли файл элемента.
+func (stor *Storage) expired(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	exp, _, err := readHeader(f)
+	if err != nil {
+		return false
+	}
+
+	return exp > 0 && time.Unix(exp, 0).Before(time.Now())
 }
 
+// pathByKey возвращает путь к файлу элемента: первые байты хеша ключа
+// образуют подкаталоги, количество которых задаётся параметром Depth.
 func (stor *Storage) pathByKey(key string) string {
-	stor.hash.Reset()
-	stor.hash.Write([]byte(key))
-	h := stor.hash.Sum(nil)
+	h := stor.sum(key)
+
+	b := strings.Builder{}
+	b.WriteString(stor.dir)
+	for _, c := range h[:stor.depth] {
+		fmt.Fprintf(&b, "/%02x", c)
+	}
+	fmt.Fprintf(&b, "/%x%s", h[stor.depth:], fileExtension)
+
+	return b.String()
+}
+
+func (stor *Storage) pathByTag(tag string) string {
+	h := stor.sum(tag)
+
+	return fmt.Sprintf("%s/%s/%x%s", stor.dir, tagDir, h, tagExtension)
+}
+
+func (stor *Storage) sum(s string) []byte {
+	h := stor.hash.New()
+	h.Write([]byte(s))
+
+	return h.Sum(nil)
+}
+
+// version возвращает контрольную сумму содержимого файла элемента.
+func version(exp int64, data []byte) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, exp)
+	h.Write(data)
 
-	return fmt.Sprintf("%s/%02x/%x%s", stor.dir, h[0], h[1:], fileExtension)
+	return h.Sum64()
 }
@@ -3,6 +3,7 @@ package memcached
 
 import (
 	"fmt"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -57,9 +58,20 @@ func (stor *Storage) Get(key string) ([]byte, error) {
 		return nil, err
 	}
 
+	data := item.Value
+
+	if item.Flags&flagTagged != 0 {
+		var ok bool
+		data, ok = stor.validate(data)
+		if !ok {
+			atomic.AddInt64(&stor.misses, 1)
+			return nil, storage.ErrNotFound
+		}
+	}
+
 	atomic.AddInt64(&stor.hits, 1)
 
-	return item.Value, nil
+	return data, nil
 }
 
 func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
@@ -77,6 +89,236 @@ func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
 	return nil
 }
 
+// Add сохраняет данные, только если элемент отсутствует, иначе возвращает storage.ErrExists.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	item := &memcache.Item{
+		Key:        stor.prefix + key,
+		Value:      data,
+		Expiration: stor.expire(ttl),
+	}
+
+	err := stor.client.Add(item)
+	if err == memcache.ErrNotStored {
+		return storage.ErrExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Increment увеличивает числовое значение элемента на delta командой incr и возвращает результат.
+// Отсутствующий элемент создаётся командой add со значением initial + delta и временем хранения ttl,
+// время устаревания существующего элемента не изменяется.
+// Memcached хранит беззнаковые значения, поэтому результат не может быть меньше нуля.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	k := stor.prefix + key
+
+	for {
+		var n uint64
+		var err error
+
+		if delta >= 0 {
+			n, err = stor.client.Increment(k, uint64(delta))
+		} else {
+			n, err = stor.client.Decrement(k, uint64(-delta))
+		}
+		if err == nil {
+			return int64(n), nil
+		}
+		if err != memcache.ErrCacheMiss {
+			return 0, err
+		}
+
+		v := initial + delta
+		if v < 0 {
+			return 0, storage.ErrInvalidData
+		}
+
+		item := &memcache.Item{
+			Key:        k,
+			Value:      strconv.AppendInt(nil, v, 10),
+			Expiration: stor.expire(ttl),
+		}
+
+		// элемент мог быть создан одновременно в другом процессе
+		err = stor.client.Add(item)
+		if err == memcache.ErrNotStored {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		return v, nil
+	}
+}
+
+// Decrement уменьшает числовое значение элемента на delta командой decr, см. Increment.
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return stor.Increment(key, -delta, initial, ttl)
+}
+
+// GetVersioned возвращает данные и версию элемента для CompareAndSwap.
+// Версией служит элемент memcache.Item с уникальным значением CAS.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	item, err := stor.client.Get(stor.prefix + key)
+	if err == memcache.ErrCacheMiss {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := item.Value
+
+	if item.Flags&flagTagged != 0 {
+		var ok bool
+		data, ok = stor.validate(data)
+		if !ok {
+			atomic.AddInt64(&stor.misses, 1)
+			return nil, nil, storage.ErrNotFound
+		}
+	}
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	return data, item, nil
+}
+
+// CompareAndSwap сохраняет данные командой cas, только если элемент не изменился после чтения
+// с помощью GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	item, ok := version.(*memcache.Item)
+	if !ok || item.Key != stor.prefix+key {
+		return storage.ErrVersionMismatch
+	}
+
+	// теги и их версии сохраняются, чтобы элемент оставался связан с тегами
+	if item.Flags&flagTagged != 0 {
+		tags, versions, _, ok := decodeTagged(item.Value)
+		if !ok {
+			return storage.ErrVersionMismatch
+		}
+		data = encodeTagged(tags, versions, data)
+	}
+
+	item.Value = data
+	item.Expiration = stor.expire(ttl)
+
+	err := stor.client.CompareAndSwap(item)
+	switch err {
+	case nil:
+		return nil
+	case memcache.ErrCASConflict:
+		return storage.ErrVersionMismatch
+	case memcache.ErrNotStored, memcache.ErrCacheMiss:
+		return storage.ErrNotFound
+	default:
+		return err
+	}
+}
+
+// GetMulti читает данные по нескольким ключам одним запросом к каждому серверу.
+// Возвращает найденные данные и ошибки по ключам.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	items := make(map[string][]byte, len(keys))
+	errs := map[string]error{}
+
+	if len(keys) == 0 {
+		return items, errs
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = stor.prefix + key
+	}
+
+	// при ошибке части серверов возвращаются элементы, полученные от остальных
+	found, err := stor.client.GetMulti(prefixed)
+
+	for i, key := range keys {
+		item, ok := found[prefixed[i]]
+		if !ok {
+			if err != nil {
+				errs[key] = err
+				continue
+			}
+
+			atomic.AddInt64(&stor.misses, 1)
+			errs[key] = storage.ErrNotFound
+			continue
+		}
+
+		data := item.Value
+
+		if item.Flags&flagTagged != 0 {
+			data, ok = stor.validate(data)
+			if !ok {
+				atomic.AddInt64(&stor.misses, 1)
+				errs[key] = storage.ErrNotFound
+				continue
+			}
+		}
+
+		atomic.AddInt64(&stor.hits, 1)
+		items[key] = data
+	}
+
+	return items, errs
+}
+
+// SetMulti сохраняет несколько элементов и возвращает ошибки по ключам.
+// Memcached не поддерживает пакетную запись, поэтому элементы сохраняются по одному.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	return storage.SetMulti(items, func(key string, data []byte) error {
+		return stor.Set(key, data, ttl)
+	})
+}
+
+// SetTagged сохраняет данные с тегами, см. InvalidateTags.
+// Вместе с данными сохраняются текущие версии тегов.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return stor.Set(key, data, ttl)
+	}
+
+	versions, err := stor.tagVersions(tags, true)
+	if err != nil {
+		return err
+	}
+
+	item := &memcache.Item{
+		Key:        stor.prefix + key,
+		Value:      encodeTagged(tags, versions, data),
+		Flags:      flagTagged,
+		Expiration: stor.expire(ttl),
+	}
+
+	err = stor.client.Set(item)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InvalidateTags делает недействительными все элементы, сохранённые с любым из указанных тегов.
+// Memcached не позволяет перечислить ключи, поэтому увеличивается версия тега,
+// а элементы с прежней версией считаются отсутствующими.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	for _, tag := range tags {
+		_, err := stor.client.Increment(stor.tagKey(tag), 1)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (stor *Storage) Delete(key string) error {
 	err := stor.client.Delete(stor.prefix + key)
 	if err != nil {
@@ -86,6 +328,11 @@ func (stor *Storage) Delete(key string) error {
 	return nil
 }
 
+// DeleteMulti удаляет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	return storage.DeleteMulti(keys, stor.Delete)
+}
+
 func (stor *Storage) DeleteAll() error {
 	err := stor.client.DeleteAll()
 	if err != nil {
@@ -0,0 +1,131 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const (
+	// flagTagged отмечает элементы, сохранённые с тегами.
+	flagTagged = 1 << 0
+)
+
+// tagVersions возвращает текущие версии тегов. Если версия тега отсутствует,
+// то при create = true она создаётся, иначе возвращается нулевая версия.
+// Начальная версия равна текущему времени, поэтому после вытеснения версии
+// из памяти прежние элементы не становятся действительными.
+func (stor *Storage) tagVersions(tags []string, create bool) ([]uint64, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = stor.tagKey(tag)
+	}
+
+	items, err := stor.client.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint64, len(tags))
+
+	for i, key := range keys {
+		item, ok := items[key]
+		if !ok {
+			if !create {
+				continue
+			}
+
+			item = &memcache.Item{
+				Key:   key,
+				Value: []byte(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			}
+
+			err := stor.client.Add(item)
+			if err == memcache.ErrNotStored {
+				item, err = stor.client.Get(key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		versions[i], _ = strconv.ParseUint(string(item.Value), 10, 64)
+	}
+
+	return versions, nil
+}
+
+// validate проверяет версии тегов элемента и возвращает его данные.
+func (stor *Storage) validate(b []byte) ([]byte, bool) {
+	tags, versions, data, ok := decodeTagged(b)
+	if !ok {
+		return nil, false
+	}
+
+	current, err := stor.tagVersions(tags, false)
+	if err != nil {
+		return nil, false
+	}
+
+	for i, v := range versions {
+		if current[i] == 0 || current[i] != v {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+func (stor *Storage) tagKey(tag string) string {
+	return stor.prefix + "(tag)" + tag
+}
+
+// Формат: количество тегов (uint16), затем для каждого тега длина (uint16),
+// название и версия (uint64), затем данные.
+func encodeTagged(tags []string, versions []uint64, data []byte) []byte {
+	size := 2 + len(data)
+	for _, tag := range tags {
+		size += 2 + len(tag) + 8
+	}
+
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(tags)))
+	for i, tag := range tags {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(tag)))
+		b = append(b, tag...)
+		b = binary.BigEndian.AppendUint64(b, versions[i])
+	}
+
+	return append(b, data...)
+}
+
+func decodeTagged(b []byte) ([]string, []uint64, []byte, bool) {
+	if len(b) < 2 {
+		return nil, nil, nil, false
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+
+	tags := make([]string, n)
+	versions := make([]uint64, n)
+
+	for i := 0; i < n; i++ {
+		if len(b) < 2 {
+			return nil, nil, nil, false
+		}
+
+		l := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+l+8 {
+			return nil, nil, nil, false
+		}
+
+		tags[i] = string(b[2 : 2+l])
+		versions[i] = binary.BigEndian.Uint64(b[2+l:])
+		b = b[2+l+8:]
+	}
+
+	return tags, versions, b, true
+}
@@ -8,8 +8,10 @@ import (
 
 type Config struct {
 	storage.Config
-	Size int64    `json:"size"`
-	GC   ConfigGC `json:"gc"`
+	Size   int64    `json:"size"`   // максимальный размер в мегабайтах, 0 — без ограничения
+	Policy string   `json:"policy"` // политика вытеснения, например PolicyLRU
+	Shards int      `json:"shards"` // количество сегментов с отдельными блокировками
+	GC     ConfigGC `json:"gc"`
 }
 
 type ConfigGC struct {
@@ -20,6 +22,8 @@ func DefaultConfig() Config {
 	return Config{
 		Config: storage.DefaultConfig(),
 		Size:   32,
+		Policy: PolicyLRU,
+		Shards: 16,
 		GC: ConfigGC{
 			Interval: 60 * time.Second,
 		},
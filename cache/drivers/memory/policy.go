@@ -0,0 +1,330 @@
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Политики вытеснения.
+const (
+	PolicyLRU     = "lru"     // вытесняются давно не использованные элементы
+	PolicyLFU     = "lfu"     // вытесняются редко используемые элементы
+	PolicyTinyLFU = "tinylfu" // W-TinyLFU: LRU-окно для новых элементов и SLRU с частотным фильтром
+	PolicyTTL     = "ttl"     // вытесняются элементы, которые устаревают раньше остальных
+)
+
+// policy определяет порядок вытеснения элементов сегмента.
+// Методы вызываются под блокировкой сегмента.
+type policy interface {
+	add(item *storageItem)
+	access(item *storageItem)
+	remove(item *storageItem)
+	victim() *storageItem
+}
+
+func newPolicy(name string) policy {
+	switch name {
+	case PolicyLRU, "":
+		return newLRUPolicy()
+	case PolicyLFU:
+		return newLFUPolicy()
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy()
+	case PolicyTTL:
+		return newTTLPolicy()
+	default:
+		panic("invalid cache eviction policy: " + name)
+	}
+}
+
+// lruPolicy хранит элементы в списке в порядке использования, O(1).
+type lruPolicy struct {
+	list *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{list.New()}
+}
+
+func (p *lruPolicy) add(item *storageItem) {
+	item.element = p.list.PushFront(item)
+}
+
+func (p *lruPolicy) access(item *storageItem) {
+	p.list.MoveToFront(item.element)
+}
+
+func (p *lruPolicy) remove(item *storageItem) {
+	p.list.Remove(item.element)
+	item.element = nil
+}
+
+func (p *lruPolicy) victim() *storageItem {
+	e := p.list.Back()
+	if e == nil {
+		return nil
+	}
+
+	return e.Value.(*storageItem)
+}
+
+// lfuPolicy хранит список частот по возрастанию, у каждой частоты — список элементов
+// в порядке использования, поэтому все операции выполняются за O(1).
+type lfuPolicy struct {
+	nodes *list.List
+}
+
+type lfuNode struct {
+	freq  int64
+	items *list.List
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{list.New()}
+}
+
+func (p *lfuPolicy) add(item *storageItem) {
+	front := p.nodes.Front()
+	if front == nil || front.Value.(*lfuNode).freq != 1 {
+		front = p.nodes.PushFront(&lfuNode{1, list.New()})
+	}
+
+	item.node = front
+	item.element = front.Value.(*lfuNode).items.PushFront(item)
+}
+
+func (p *lfuPolicy) access(item *storageItem) {
+	current := item.node
+	n := current.Value.(*lfuNode)
+
+	next := current.Next()
+	if next == nil || next.Value.(*lfuNode).freq != n.freq+1 {
+		next = p.nodes.InsertAfter(&lfuNode{n.freq + 1, list.New()}, current)
+	}
+
+	n.items.Remove(item.element)
+	if n.items.Len() == 0 {
+		p.nodes.Remove(current)
+	}
+
+	item.node = next
+	item.element = next.Value.(*lfuNode).items.PushFront(item)
+}
+
+func (p *lfuPolicy) remove(item *storageItem) {
+	n := item.node.Value.(*lfuNode)
+
+	n.items.Remove(item.element)
+	if n.items.Len() == 0 {
+		p.nodes.Remove(item.node)
+	}
+
+	item.node = nil
+	item.element = nil
+}
+
+func (p *lfuPolicy) victim() *storageItem {
+	front := p.nodes.Front()
+	if front == nil {
+		return nil
+	}
+
+	return front.Value.(*lfuNode).items.Back().Value.(*storageItem)
+}
+
+// Области W-TinyLFU.
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFUPolicy реализует W-TinyLFU. Новые элементы попадают в LRU-окно размером 1% элементов.
+// При вытеснении старейший элемент окна сравнивается по оценке частотного фильтра
+// с кандидатом на вытеснение из основной области, и вытесняется менее используемый.
+// Основная область состоит из испытательной и защищённой (80%) частей; элемент попадает
+// в защищённую часть при повторном использовании.
+type tinyLFUPolicy struct {
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	sketch    *sketch
+}
+
+func newTinyLFUPolicy() *tinyLFUPolicy {
+	p := new(tinyLFUPolicy)
+	p.window = list.New()
+	p.probation = list.New()
+	p.protected = list.New()
+	p.sketch = newSketch(4096)
+
+	return p
+}
+
+func (p *tinyLFUPolicy) add(item *storageItem) {
+	p.sketch.add(item.key)
+
+	item.segment = segmentWindow
+	item.element = p.window.PushFront(item)
+
+	// окно занимает 1% элементов, остальные переходят в испытательную часть
+	windowMax := (p.window.Len() + p.probation.Len() + p.protected.Len()) / 100
+	if windowMax < 1 {
+		windowMax = 1
+	}
+
+	for p.window.Len() > windowMax {
+		e := p.window.Back()
+		moved := e.Value.(*storageItem)
+		p.window.Remove(e)
+		moved.segment = segmentProbation
+		moved.element = p.probation.PushFront(moved)
+	}
+}
+
+func (p *tinyLFUPolicy) access(item *storageItem) {
+	p.sketch.add(item.key)
+
+	switch item.segment {
+	case segmentWindow:
+		p.window.MoveToFront(item.element)
+
+	case segmentProbation:
+		p.probation.Remove(item.element)
+		item.segment = segmentProtected
+		item.element = p.protected.PushFront(item)
+
+		main := p.probation.Len() + p.protected.Len()
+		if p.protected.Len() > main*8/10 {
+			demoted := p.protected.Back().Value.(*storageItem)
+			p.protected.Remove(demoted.element)
+			demoted.segment = segmentProbation
+			demoted.element = p.probation.PushFront(demoted)
+		}
+
+	case segmentProtected:
+		p.protected.MoveToFront(item.element)
+	}
+}
+
+func (p *tinyLFUPolicy) remove(item *storageItem) {
+	p.segmentList(item.segment).Remove(item.element)
+	item.element = nil
+}
+
+func (p *tinyLFUPolicy) victim() *storageItem {
+	mainVictim := p.mainVictim()
+
+	e := p.window.Back()
+	if e == nil {
+		return mainVictim
+	}
+
+	candidate := e.Value.(*storageItem)
+	if mainVictim == nil || p.sketch.estimate(candidate.key) <= p.sketch.estimate(mainVictim.key) {
+		return candidate
+	}
+
+	p.window.Remove(candidate.element)
+	candidate.segment = segmentProbation
+	candidate.element = p.probation.PushFront(candidate)
+
+	return mainVictim
+}
+
+func (p *tinyLFUPolicy) mainVictim() *storageItem {
+	if e := p.probation.Back(); e != nil {
+		return e.Value.(*storageItem)
+	}
+	if e := p.protected.Back(); e != nil {
+		return e.Value.(*storageItem)
+	}
+
+	return nil
+}
+
+func (p *tinyLFUPolicy) segmentList(segment int) *list.List {
+	switch segment {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+// ttlPolicy вытесняет сначала элементы с наименьшим временем устаревания, O(log n),
+// затем элементы без ограничения времени хранения в порядке LRU, O(1).
+type ttlPolicy struct {
+	heap ttlHeap
+	lru  *lruPolicy
+}
+
+func newTTLPolicy() *ttlPolicy {
+	return &ttlPolicy{lru: newLRUPolicy()}
+}
+
+func (p *ttlPolicy) add(item *storageItem) {
+	if item.expire > 0 {
+		heap.Push(&p.heap, item)
+	} else {
+		item.index = -1
+		p.lru.add(item)
+	}
+}
+
+func (p *ttlPolicy) access(item *storageItem) {
+	// время устаревания могло измениться при перезаписи элемента
+	p.remove(item)
+	p.add(item)
+}
+
+func (p *ttlPolicy) remove(item *storageItem) {
+	if item.index >= 0 {
+		heap.Remove(&p.heap, item.index)
+	} else {
+		p.lru.remove(item)
+	}
+}
+
+func (p *ttlPolicy) victim() *storageItem {
+	if len(p.heap) > 0 {
+		return p.heap[0]
+	}
+
+	return p.lru.victim()
+}
+
+type ttlHeap []*storageItem
+
+func (h ttlHeap) Len() int {
+	return len(h)
+}
+
+func (h ttlHeap) Less(i, j int) bool {
+	return h[i].expire < h[j].expire
+}
+
+func (h ttlHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ttlHeap) Push(x interface{}) {
+	item := x.(*storageItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *ttlHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+
+	return item
+}
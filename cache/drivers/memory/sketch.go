@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"hash/fnv"
+)
+
+const (
+	sketchDepth = 4
+)
+
+// sketch — частотный фильтр count-min с 8-битными счётчиками.
+// После 10×width добавлений все счётчики уменьшаются вдвое,
+// чтобы старые обращения постепенно теряли вес.
+type sketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// newSketch создаёт фильтр; width округляется вверх до степени двойки.
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+
+	s := new(sketch)
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	s.mask = uint64(w - 1)
+	s.resetAt = 10 * w
+
+	return s
+}
+
+func (s *sketch) add(key string) {
+	h1, h2 := sketchHash(key)
+
+	for i := range s.rows {
+		j := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][j] < 255 {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := sketchHash(key)
+
+	min := uint8(255)
+	for i := range s.rows {
+		j := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+
+	return min
+}
+
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func sketchHash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+
+	return sum, sum>>32 | 1
+}
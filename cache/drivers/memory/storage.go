@@ -1,8 +1,17 @@
 // Пакет memory реализует драйвер для хранения данных в памяти приложения.
+//
+// Элементы распределяются по сегментам с отдельными блокировками. Ограничение размера Size
+// общее для всех сегментов, размер одного элемента не может превышать Size.
+// При превышении ограничения элементы вытесняются по одному в порядке, который задаёт
+// политика вытеснения, см. PolicyLRU: сначала из сегмента, в который записывается элемент,
+// затем из остальных сегментов. Сегменты, заблокированные другими операциями, пропускаются,
+// поэтому общий размер может ненадолго превысить Size, пока вытеснение не продолжит
+// следующая запись.
 package memory
 
 import (
-	"sort"
+	"hash/maphash"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,25 +21,60 @@ import (
 )
 
 type Storage struct {
-	items      map[string]*storageItem
-	itemsMutex sync.RWMutex
+	shards []*shard
+	seed   maphash.Seed
+	policy string
 
 	ttlDefault time.Duration
 	ttlMax     time.Duration
 
 	gc *helpers.Interval
 
+	// общий размер элементов всех сегментов и ограничение размера
 	size    int64
 	sizeMax int64
 
-	hits   int64
-	misses int64
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type shard struct {
+	items map[string]*storageItem
+	mutex sync.Mutex
+
+	// ключи элементов по тегам
+	tags map[string]map[string]struct{}
+
+	policy policy
+
+	// последняя выданная версия элемента, см. CompareAndSwap
+	version uint64
+
+	// размер элементов сегмента, учитывается также в общем размере total
+	size  int64
+	total *int64
 }
 
 func NewStorage(conf Config) *Storage {
 	stor := new(Storage)
 
-	stor.items = map[string]*storageItem{}
+	shards := conf.Shards
+	if shards < 1 {
+		shards = 1
+	}
+
+	stor.seed = maphash.MakeSeed()
+	stor.policy = conf.Policy
+	stor.sizeMax = conf.Size * 1024 * 1024
+	stor.shards = make([]*shard, shards)
+	for i := range stor.shards {
+		s := new(shard)
+		s.total = &stor.size
+		s.reset(conf.Policy)
+
+		stor.shards[i] = s
+	}
 
 	stor.ttlDefault = conf.TTL.Default
 	stor.ttlMax = conf.TTL.Maximum
@@ -41,136 +85,384 @@ func NewStorage(conf Config) *Storage {
 		stor.gc.Start()
 	}
 
-	stor.sizeMax = conf.Size * 1024 * 1024
-
 	return stor
 }
 
 func (stor *Storage) Get(key string) ([]byte, error) {
-	stor.itemsMutex.RLock()
-	defer stor.itemsMutex.RUnlock()
+	s := stor.shard(key)
 
-	item, ok := stor.items[key]
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
 	if !ok {
 		atomic.AddInt64(&stor.misses, 1)
 		return nil, storage.ErrNotFound
 	}
 
 	if item.isExpired() {
+		s.remove(item)
 		atomic.AddInt64(&stor.misses, 1)
 		return nil, storage.ErrExpired
 	}
 
+	s.policy.access(item)
+
 	atomic.AddInt64(&stor.hits, 1)
-	atomic.AddInt64(&item.hits, 1)
 
 	return item.data, nil
 }
 
 func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
+	return stor.SetTagged(key, data, ttl)
+}
+
+// SetTagged сохраняет данные с тегами, см. InvalidateTags.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	s := stor.shard(key)
+
 	if stor.sizeMax > 0 && int64(len(data)) > stor.sizeMax {
 		return storage.ErrInvalidData
 	}
 
-	stor.itemsMutex.Lock()
-	defer stor.itemsMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	item, ok := stor.items[key]
-	if ok {
-		stor.size -= item.size()
-	} else {
-		item = new(storageItem)
-		item.created = time.Now().Unix()
+	stor.set(s, key, data, ttl, tags)
+
+	return nil
+}
+
+// Add сохраняет данные, только если элемент отсутствует, иначе возвращает storage.ErrExists.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	s := stor.shard(key)
+
+	if stor.sizeMax > 0 && int64(len(data)) > stor.sizeMax {
+		return storage.ErrInvalidData
 	}
 
-	item.expire = storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
-	item.data = data
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	itemSize := item.size()
+	if s.lookup(key) != nil {
+		return storage.ErrExists
+	}
 
-	if stor.sizeMax > 0 && stor.size+itemSize > stor.sizeMax {
-		size1 := stor.sizeMax - itemSize
-		size2 := stor.sizeMax / 2
-		if size1 < size2 {
-			stor.truncate(size1)
-		} else {
-			stor.truncate(size2)
-		}
+	stor.set(s, key, data, ttl, nil)
+
+	return nil
+}
+
+// Increment увеличивает числовое значение элемента на delta и возвращает результат.
+// Отсутствующий элемент создаётся со значением initial + delta и временем хранения ttl,
+// время устаревания существующего элемента не изменяется.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	s := stor.shard(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item := s.lookup(key)
+	if item == nil {
+		n := initial + delta
+		stor.set(s, key, strconv.AppendInt(nil, n, 10), ttl, nil)
+		return n, nil
+	}
+
+	n, err := strconv.ParseInt(string(item.data), 10, 64)
+	if err != nil {
+		return 0, storage.ErrInvalidData
+	}
+	n += delta
+
+	s.resize(-item.size())
+	item.data = strconv.AppendInt(nil, n, 10)
+	item.version = s.nextVersion()
+	s.resize(item.size())
+
+	s.policy.access(item)
+
+	return n, nil
+}
+
+// Decrement уменьшает числовое значение элемента на delta, см. Increment.
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return stor.Increment(key, -delta, initial, ttl)
+}
+
+// GetVersioned возвращает данные и версию элемента для CompareAndSwap.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	s := stor.shard(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item := s.lookup(key)
+	if item == nil {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, nil, storage.ErrNotFound
 	}
 
-	stor.items[key] = item
-	stor.size += itemSize
+	s.policy.access(item)
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	return item.data, item.version, nil
+}
+
+// CompareAndSwap сохраняет данные, только если версия элемента не изменилась после чтения
+// с помощью GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	s := stor.shard(key)
+
+	if stor.sizeMax > 0 && int64(len(data)) > stor.sizeMax {
+		return storage.ErrInvalidData
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item := s.lookup(key)
+	if item == nil {
+		return storage.ErrNotFound
+	}
+
+	if v, ok := version.(uint64); !ok || v != item.version {
+		return storage.ErrVersionMismatch
+	}
+
+	stor.set(s, key, data, ttl, item.tags)
 
 	return nil
 }
 
 func (stor *Storage) Delete(key string) error {
-	stor.itemsMutex.Lock()
-	defer stor.itemsMutex.Unlock()
+	s := stor.shard(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	item, ok := stor.items[key]
+	item, ok := s.items[key]
 	if !ok {
 		return storage.ErrNotFound
 	}
 
-	stor.size -= item.size()
-	delete(stor.items, key)
+	s.remove(item)
 
 	return nil
 }
 
-func (stor *Storage) DeleteAll() error {
-	stor.itemsMutex.Lock()
-	defer stor.itemsMutex.Unlock()
+// GetMulti читает данные по нескольким ключам. Возвращает найденные данные и ошибки по ключам.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	return storage.GetMulti(keys, stor.Get)
+}
 
-	stor.items = map[string]*storageItem{}
-	stor.size = 0
+// SetMulti сохраняет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	return storage.SetMulti(items, func(key string, data []byte) error {
+		return stor.Set(key, data, ttl)
+	})
+}
+
+// DeleteMulti удаляет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	return storage.DeleteMulti(keys, stor.Delete)
+}
+
+// InvalidateTags удаляет все элементы, сохранённые с любым из указанных тегов.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	for _, s := range stor.shards {
+		s.mutex.Lock()
+		for _, tag := range tags {
+			for key := range s.tags[tag] {
+				s.remove(s.items[key])
+			}
+		}
+		s.mutex.Unlock()
+	}
+
+	return nil
+}
+
+func (stor *Storage) DeleteAll() error {
+	for _, s := range stor.shards {
+		s.mutex.Lock()
+		s.reset(stor.policy)
+		s.mutex.Unlock()
+	}
 
 	return nil
 }
 
 func (stor *Storage) Hits() int64 {
-	return stor.hits
+	return atomic.LoadInt64(&stor.hits)
 }
 
 func (stor *Storage) Misses() int64 {
-	return stor.misses
+	return atomic.LoadInt64(&stor.misses)
 }
 
-func (stor *Storage) gcRun() {
-	stor.itemsMutex.Lock()
-	defer stor.itemsMutex.Unlock()
+// Evictions возвращает количество элементов, вытесненных из-за ограничения размера.
+func (stor *Storage) Evictions() int64 {
+	return atomic.LoadInt64(&stor.evictions)
+}
 
-	for key, item := range stor.items {
-		if item.isExpired() {
-			stor.size -= item.size()
-			delete(stor.items, key)
+func (stor *Storage) gcRun() {
+	for _, s := range stor.shards {
+		s.mutex.Lock()
+		for _, item := range s.items {
+			if item.isExpired() {
+				s.remove(item)
+			}
 		}
+		s.mutex.Unlock()
 	}
 }
 
-func (stor *Storage) truncate(size int64) {
-	if stor.size <= size {
-		return
+// set сохраняет элемент и вытесняет другие элементы при превышении ограничения размера.
+// Вызывается под блокировкой сегмента.
+func (stor *Storage) set(s *shard, key string, data []byte, ttl time.Duration, tags []string) {
+	item, ok := s.items[key]
+	if ok {
+		s.resize(-item.size())
+		s.untag(item)
+	} else {
+		item = new(storageItem)
+		item.key = key
 	}
 
-	if size <= 0 {
-		stor.size = 0
-		stor.items = map[string]*storageItem{}
+	item.expire = storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+	item.data = data
+	item.tags = tags
+	item.version = s.nextVersion()
+
+	s.resize(item.size())
+	s.tag(item)
+
+	if ok {
+		s.policy.access(item)
+	} else {
+		s.items[key] = item
+		s.policy.add(item)
+	}
+
+	stor.evict(s, item)
+}
+
+// evict вытесняет элементы после записи элемента item в сегмент s, пока общий размер
+// превышает ограничение. Сначала вытесняются элементы сегмента s, если его размер больше
+// средней доли, затем элементы остальных сегментов, блокировку которых удаётся получить
+// без ожидания, и в последнюю очередь остальные элементы сегмента s. Размер сегмента s
+// не уменьшается меньше размера item, поэтому записанный элемент может быть вытеснен
+// только по решению политики. Вызывается под блокировкой сегмента s.
+func (stor *Storage) evict(s *shard, item *storageItem) {
+	if stor.sizeMax <= 0 || stor.overflow() <= 0 {
 		return
 	}
 
-	index := newIndex(stor.items)
-	sort.Sort(index)
+	stor.evictFrom(s, max(stor.sizeMax/int64(len(stor.shards)), item.size()))
+
+	for _, other := range stor.shards {
+		if stor.overflow() <= 0 {
+			return
+		}
+		if other == s || !other.mutex.TryLock() {
+			continue
+		}
 
-	for _, indexItem := range index {
-		item := stor.items[indexItem.key]
+		stor.evictFrom(other, 0)
+		other.mutex.Unlock()
+	}
 
-		stor.size -= item.size()
-		delete(stor.items, indexItem.key)
+	stor.evictFrom(s, item.size())
+}
 
-		if stor.size <= size {
+// evictFrom вытесняет элементы сегмента, пока общий размер превышает ограничение,
+// а размер сегмента больше keep. Вызывается под блокировкой сегмента.
+func (stor *Storage) evictFrom(s *shard, keep int64) {
+	for stor.overflow() > 0 && s.size > keep {
+		victim := s.policy.victim()
+		if victim == nil {
 			return
 		}
+
+		s.remove(victim)
+		atomic.AddInt64(&stor.evictions, 1)
+	}
+}
+
+// overflow возвращает превышение общего размера над ограничением.
+func (stor *Storage) overflow() int64 {
+	return atomic.LoadInt64(&stor.size) - stor.sizeMax
+}
+
+func (stor *Storage) shard(key string) *shard {
+	if len(stor.shards) == 1 {
+		return stor.shards[0]
+	}
+
+	h := maphash.String(stor.seed, key)
+	return stor.shards[h%uint64(len(stor.shards))]
+}
+
+func (s *shard) reset(policy string) {
+	s.items = map[string]*storageItem{}
+	s.tags = map[string]map[string]struct{}{}
+	s.policy = newPolicy(policy)
+	s.resize(-s.size)
+}
+
+// lookup возвращает действительный элемент или nil, устаревший элемент удаляется.
+func (s *shard) lookup(key string) *storageItem {
+	item, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+
+	if item.isExpired() {
+		s.remove(item)
+		return nil
+	}
+
+	return item
+}
+
+// nextVersion возвращает новую версию для изменённого элемента.
+func (s *shard) nextVersion() uint64 {
+	s.version++
+	return s.version
+}
+
+// resize изменяет размер сегмента и общий размер хранилища.
+func (s *shard) resize(delta int64) {
+	s.size += delta
+	atomic.AddInt64(s.total, delta)
+}
+
+func (s *shard) remove(item *storageItem) {
+	s.resize(-item.size())
+	s.untag(item)
+	s.policy.remove(item)
+	delete(s.items, item.key)
+}
+
+func (s *shard) tag(item *storageItem) {
+	for _, tag := range item.tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			s.tags[tag] = keys
+		}
+		keys[item.key] = struct{}{}
+	}
+}
+
+func (s *shard) untag(item *storageItem) {
+	for _, tag := range item.tags {
+		keys := s.tags[tag]
+		delete(keys, item.key)
+		if len(keys) == 0 {
+			delete(s.tags, tag)
+		}
 	}
 }
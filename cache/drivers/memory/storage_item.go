@@ -1,14 +1,23 @@
 package memory
 
 import (
+	"container/list"
 	"time"
 )
 
 type storageItem struct {
-	created int64
-	expire  int64
-	hits    int64
-	data    []byte
+	key    string
+	expire int64
+	data   []byte
+	tags   []string
+
+	version uint64
+
+	// положение элемента в структурах политики вытеснения
+	element *list.Element
+	node    *list.Element
+	segment int
+	index   int
 }
 
 func (item *storageItem) isExpired() bool {
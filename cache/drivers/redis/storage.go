@@ -11,6 +11,24 @@ import (
 	"github.com/olegshs/go-tools/cache/storage"
 )
 
+// compareAndSwapScript сохраняет значение, если контрольная сумма SHA-1 текущего значения
+// совпадает с версией. Возвращает -1, если значение отсутствует, и 0 при несовпадении версии.
+var compareAndSwapScript = redis.NewScript(1, `
+	local value = redis.call('GET', KEYS[1])
+	if not value then
+		return -1
+	end
+	if redis.sha1hex(value) ~= ARGV[1] then
+		return 0
+	end
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	else
+		redis.call('SET', KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
 type Storage struct {
 	pool *redis.Pool
 
@@ -25,7 +43,19 @@ type Storage struct {
 
 func NewStorage(conf Config) *Storage {
 	stor := new(Storage)
-	stor.pool = &redis.Pool{
+	stor.pool = NewPool(conf)
+
+	stor.prefix = conf.Prefix
+
+	stor.ttlDefault = conf.TTL.Default
+	stor.ttlMax = conf.TTL.Maximum
+
+	return stor
+}
+
+// NewPool создаёт пул соединений с Redis по параметрам конфигурации.
+func NewPool(conf Config) *redis.Pool {
+	return &redis.Pool{
 		Dial: func() (conn redis.Conn, err error) {
 			address := fmt.Sprintf("%s:%d", conf.Host, conf.Port)
 			options := []redis.DialOption{
@@ -40,16 +70,9 @@ func NewStorage(conf Config) *Storage {
 		Wait:            conf.Pool.Wait,
 		MaxConnLifetime: conf.Pool.MaxConnLifetime,
 	}
-
-	stor.prefix = conf.Prefix
-
-	stor.ttlDefault = conf.TTL.Default
-	stor.ttlMax = conf.TTL.Maximum
-
-	return stor
 }
 
-func (stor Storage) Get(key string) ([]byte, error) {
+func (stor *Storage) Get(key string) ([]byte, error) {
 	conn := stor.pool.Get()
 	defer conn.Close()
 
@@ -62,18 +85,24 @@ func (stor Storage) Get(key string) ([]byte, error) {
 		return nil, err
 	}
 
+	data, ok := stor.unpack(conn, b)
+	if !ok {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, storage.ErrNotFound
+	}
+
 	atomic.AddInt64(&stor.hits, 1)
 
-	return b, nil
+	return data, nil
 }
 
-func (stor Storage) Set(key string, data []byte, ttl time.Duration) error {
+func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
 	conn := stor.pool.Get()
 	defer conn.Close()
 
 	args := []interface{}{
 		stor.prefix + key,
-		data,
+		pack(data),
 	}
 
 	expire := stor.expire(ttl)
@@ -89,7 +118,268 @@ func (stor Storage) Set(key string, data []byte, ttl time.Duration) error {
 	return nil
 }
 
-func (stor Storage) Delete(key string) error {
+// Add сохраняет данные командой SET NX, только если элемент отсутствует,
+// иначе возвращает storage.ErrExists.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{
+		stor.prefix + key,
+		pack(data),
+		"NX",
+	}
+
+	expire := stor.expire(ttl)
+	if expire > 0 {
+		args = append(args, "PX", expire)
+	}
+
+	_, err := redis.String(conn.Do("SET", args...))
+	if err == redis.ErrNil {
+		return storage.ErrExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Increment увеличивает числовое значение элемента на delta командой INCRBY и возвращает результат.
+// Отсутствующий элемент предварительно создаётся командой SET NX со значением initial
+// и временем хранения ttl, время устаревания существующего элемента не изменяется.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{
+		stor.prefix + key,
+		initial,
+		"NX",
+	}
+
+	expire := stor.expire(ttl)
+	if expire > 0 {
+		args = append(args, "PX", expire)
+	}
+
+	conn.Send("MULTI")
+	conn.Send("SET", args...)
+	conn.Send("INCRBY", stor.prefix+key, delta)
+
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+
+	return redis.Int64(values[1], nil)
+}
+
+// Decrement уменьшает числовое значение элемента на delta, см. Increment.
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return stor.Increment(key, -delta, initial, ttl)
+}
+
+// GetVersioned возвращает данные и версию элемента для CompareAndSwap.
+// Версией служит контрольная сумма SHA-1 хранимого значения.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	b, err := redis.Bytes(conn.Do("GET", stor.prefix+key))
+	if err == redis.ErrNil {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, ok := stor.unpack(conn, b)
+	if !ok {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, nil, storage.ErrNotFound
+	}
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	return data, version(b, data), nil
+}
+
+// CompareAndSwap сохраняет данные, только если значение не изменилось после чтения
+// с помощью GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	v, ok := version.(itemVersion)
+	if !ok {
+		return storage.ErrVersionMismatch
+	}
+
+	// теги и их версии сохраняются, чтобы элемент оставался связан с тегами
+	if len(v.header) > 0 {
+		data = append(v.header[:len(v.header):len(v.header)], data...)
+	} else {
+		data = pack(data)
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	result, err := redis.Int(compareAndSwapScript.Do(conn, stor.prefix+key, v.sum, data, stor.expire(ttl)))
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case -1:
+		return storage.ErrNotFound
+	case 0:
+		return storage.ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// GetMulti читает данные по нескольким ключам одной командой MGET.
+// Возвращает найденные данные и ошибки по ключам.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	items := make(map[string][]byte, len(keys))
+	errs := map[string]error{}
+
+	if len(keys) == 0 {
+		return items, errs
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = stor.prefix + key
+	}
+
+	values, err := redis.ByteSlices(conn.Do("MGET", args...))
+	if err != nil {
+		for _, key := range keys {
+			errs[key] = err
+		}
+		return items, errs
+	}
+
+	for i, key := range keys {
+		if values[i] == nil {
+			atomic.AddInt64(&stor.misses, 1)
+			errs[key] = storage.ErrNotFound
+			continue
+		}
+
+		data, ok := stor.unpack(conn, values[i])
+		if !ok {
+			atomic.AddInt64(&stor.misses, 1)
+			errs[key] = storage.ErrNotFound
+			continue
+		}
+
+		atomic.AddInt64(&stor.hits, 1)
+		items[key] = data
+	}
+
+	return items, errs
+}
+
+// SetMulti сохраняет несколько элементов в одном конвейере запросов
+// и возвращает ошибки по ключам.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	errs := map[string]error{}
+
+	if len(items) == 0 {
+		return errs
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	expire := stor.expire(ttl)
+
+	keys := make([]string, 0, len(items))
+	for key, data := range items {
+		args := []interface{}{
+			stor.prefix + key,
+			pack(data),
+		}
+		if expire > 0 {
+			args = append(args, "PX", expire)
+		}
+
+		conn.Send("SET", args...)
+		keys = append(keys, key)
+	}
+
+	stor.receiveAll(conn, keys, errs)
+
+	return errs
+}
+
+// SetTagged сохраняет данные с тегами, см. InvalidateTags.
+// Вместе с данными сохраняются текущие версии тегов.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return stor.Set(key, data, ttl)
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	versions, err := stor.tagVersions(conn, tags, true)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{
+		stor.prefix + key,
+		encodeTagged(tags, versions, data),
+	}
+
+	expire := stor.expire(ttl)
+	if expire > 0 {
+		args = append(args, "PX", expire)
+	}
+
+	_, err = conn.Do("SET", args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InvalidateTags делает недействительными все элементы, сохранённые с любым из указанных тегов:
+// увеличивается версия тега, а элементы с прежней версией считаются отсутствующими
+// и удаляются Redis по истечении времени хранения. Версии тегов хранятся без ограничения
+// времени, их количество равно количеству используемых тегов.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	for _, tag := range tags {
+		conn.Send("INCR", stor.tagKey(tag))
+	}
+
+	errs := map[string]error{}
+	stor.receiveAll(conn, tags, errs)
+
+	for _, err := range errs {
+		return err
+	}
+
+	return nil
+}
+
+func (stor *Storage) Delete(key string) error {
 	conn := stor.pool.Get()
 	defer conn.Close()
 
@@ -101,7 +391,28 @@ func (stor Storage) Delete(key string) error {
 	return nil
 }
 
-func (stor Storage) DeleteAll() error {
+// DeleteMulti удаляет несколько элементов в одном конвейере запросов
+// и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	errs := map[string]error{}
+
+	if len(keys) == 0 {
+		return errs
+	}
+
+	conn := stor.pool.Get()
+	defer conn.Close()
+
+	for _, key := range keys {
+		conn.Send("DEL", stor.prefix+key)
+	}
+
+	stor.receiveAll(conn, keys, errs)
+
+	return errs
+}
+
+func (stor *Storage) DeleteAll() error {
 	conn := stor.pool.Get()
 	defer conn.Close()
 
@@ -113,15 +424,15 @@ func (stor Storage) DeleteAll() error {
 	return nil
 }
 
-func (stor Storage) Hits() int64 {
+func (stor *Storage) Hits() int64 {
 	return stor.hits
 }
 
-func (stor Storage) Misses() int64 {
+func (stor *Storage) Misses() int64 {
 	return stor.misses
 }
 
-func (stor Storage) expire(ttl time.Duration) int64 {
+func (stor *Storage) expire(ttl time.Duration) int64 {
 	if ttl == storage.DefaultTTL {
 		ttl = stor.ttlDefault
 	}
@@ -132,3 +443,21 @@ func (stor Storage) expire(ttl time.Duration) int64 {
 
 	return int64(ttl / time.Millisecond)
 }
+
+// receiveAll получает ответы на отправленные по каждому ключу команды.
+func (stor *Storage) receiveAll(conn redis.Conn, keys []string, errs map[string]error) {
+	err := conn.Flush()
+	if err != nil {
+		for _, key := range keys {
+			errs[key] = err
+		}
+		return
+	}
+
+	for _, key := range keys {
+		_, err := conn.Receive()
+		if err != nil {
+			errs[key] = err
+		}
+	}
+}
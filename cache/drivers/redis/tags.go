@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// taggedHeader отмечает значения, сохранённые вместе с версиями тегов.
+// Redis не хранит флаги элементов, поэтому признак записывается в начало значения;
+// данные, которые сами начинаются с этой последовательности, сохраняются с пустым списком тегов.
+var taggedHeader = []byte("\x00(tagged)\x00")
+
+// itemVersion — версия элемента для CompareAndSwap: контрольная сумма SHA-1 хранимого значения
+// и заголовок с тегами, который сохраняется при замене данных.
+type itemVersion struct {
+	sum    string
+	header []byte
+}
+
+// tagVersions возвращает текущие версии тегов. Если версия тега отсутствует,
+// то при create = true она создаётся, иначе возвращается нулевая версия.
+// Начальная версия равна текущему времени, поэтому после вытеснения версии
+// из памяти прежние элементы не становятся действительными.
+func (stor *Storage) tagVersions(conn redis.Conn, tags []string, create bool) ([]uint64, error) {
+	args := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		args[i] = stor.tagKey(tag)
+	}
+
+	values, err := redis.Values(conn.Do("MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint64, len(tags))
+
+	for i, key := range args {
+		if values[i] == nil {
+			if !create {
+				continue
+			}
+
+			_, err := conn.Do("SET", key, time.Now().UnixNano(), "NX")
+			if err != nil {
+				return nil, err
+			}
+
+			values[i], err = conn.Do("GET", key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		s, _ := redis.String(values[i], nil)
+		versions[i], _ = strconv.ParseUint(s, 10, 64)
+	}
+
+	return versions, nil
+}
+
+// unpack возвращает данные хранимого значения, проверяя версии его тегов.
+func (stor *Storage) unpack(conn redis.Conn, b []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(b, taggedHeader) {
+		return b, true
+	}
+
+	tags, versions, data, ok := decodeTagged(b[len(taggedHeader):])
+	if !ok {
+		return nil, false
+	}
+	if len(tags) == 0 {
+		return data, true
+	}
+
+	current, err := stor.tagVersions(conn, tags, false)
+	if err != nil {
+		return nil, false
+	}
+
+	for i, v := range versions {
+		if current[i] == 0 || current[i] != v {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+// pack возвращает значение для сохранения данных без тегов.
+func pack(data []byte) []byte {
+	if !bytes.HasPrefix(data, taggedHeader) {
+		return data
+	}
+
+	return encodeTagged(nil, nil, data)
+}
+
+// version возвращает версию хранимого значения b, данные которого равны data.
+func version(b []byte, data []byte) itemVersion {
+	return itemVersion{
+		sum:    fmt.Sprintf("%x", sha1.Sum(b)),
+		header: b[:len(b)-len(data)],
+	}
+}
+
+func (stor *Storage) tagKey(tag string) string {
+	return stor.prefix + "(tag)" + tag
+}
+
+// Формат: taggedHeader, количество тегов (uint16), затем для каждого тега длина (uint16),
+// название и версия (uint64), затем данные.
+func encodeTagged(tags []string, versions []uint64, data []byte) []byte {
+	size := len(taggedHeader) + 2 + len(data)
+	for _, tag := range tags {
+		size += 2 + len(tag) + 8
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, taggedHeader...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(tags)))
+	for i, tag := range tags {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(tag)))
+		b = append(b, tag...)
+		b = binary.BigEndian.AppendUint64(b, versions[i])
+	}
+
+	return append(b, data...)
+}
+
+func decodeTagged(b []byte) ([]string, []uint64, []byte, bool) {
+	if len(b) < 2 {
+		return nil, nil, nil, false
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+
+	tags := make([]string, n)
+	versions := make([]uint64, n)
+
+	for i := 0; i < n; i++ {
+		if len(b) < 2 {
+			return nil, nil, nil, false
+		}
+
+		l := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+l+8 {
+			return nil, nil, nil, false
+		}
+
+		tags[i] = string(b[2 : 2+l])
+		versions[i] = binary.BigEndian.Uint64(b[2+l:])
+		b = b[2+l+8:]
+	}
+
+	return tags, versions, b, true
+}
@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
+)
+
+type Config struct {
+	storage.Config
+	File        string        `json:"file"`         // файл базы данных
+	Table       string        `json:"table"`        // таблица элементов
+	Sync        string        `json:"sync"`         // режим синхронизации с диском: OFF, NORMAL или FULL
+	BusyTimeout time.Duration `json:"busy_timeout"` // время ожидания блокировки базы данных
+	GC          ConfigGC      `json:"gc"`
+}
+
+type ConfigGC struct {
+	Interval time.Duration `json:"interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Config:      storage.DefaultConfig(),
+		File:        "tmp/cache.db",
+		Table:       "cache",
+		Sync:        "NORMAL",
+		BusyTimeout: 5 * time.Second,
+		GC: ConfigGC{
+			Interval: 60 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,520 @@
+// Пакет sqlite реализует драйвер для хранения данных в базе данных SQLite.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/olegshs/go-tools/cache/storage"
+	"github.com/olegshs/go-tools/config"
+	"github.com/olegshs/go-tools/helpers"
+)
+
+const (
+	// maxVariables — количество ключей в одном запросе GetMulti.
+	maxVariables = 500
+)
+
+// Storage хранит элементы в одной таблице базы данных SQLite: ключ, данные, время устаревания,
+// версию и теги. База данных работает в режиме WAL, поэтому чтение не блокируется записью.
+// Устаревшие элементы удаляются при сборке мусора.
+type Storage struct {
+	db *sql.DB
+	q  queries
+
+	// последняя версия элемента, см. GetVersioned
+	version int64
+
+	ttlDefault time.Duration
+	ttlMax     time.Duration
+
+	gc *helpers.Interval
+
+	hits   int64
+	misses int64
+}
+
+type queries struct {
+	get            string
+	getMulti       string
+	set            string
+	add            string
+	update         string
+	compareAndSwap string
+	delete         string
+	deleteAll      string
+	invalidateTags string
+	gc             string
+}
+
+func NewStorage(conf Config) *Storage {
+	stor := new(Storage)
+
+	sync := strings.ToUpper(conf.Sync)
+	switch sync {
+	case "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		panic("invalid cache sync mode: " + conf.Sync)
+	}
+
+	file := config.AbsPath(conf.File)
+
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		panic("unable to create cache database: " + err.Error())
+	}
+
+	dsn := fmt.Sprintf(
+		"file:%s?_journal_mode=WAL&_synchronous=%s&_busy_timeout=%d&_txlock=immediate",
+		file, sync, conf.BusyTimeout.Milliseconds(),
+	)
+
+	stor.db, err = sql.Open("sqlite3", dsn)
+	if err != nil {
+		panic("unable to open cache database: " + err.Error())
+	}
+
+	table := quote(conf.Table)
+
+	_, err = stor.db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		key     TEXT    NOT NULL PRIMARY KEY,
+		value   BLOB    NOT NULL,
+		expire  INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		tags    TEXT
+	) WITHOUT ROWID`)
+	if err == nil {
+		_, err = stor.db.Exec(`CREATE INDEX IF NOT EXISTS ` + quote(conf.Table+"_expire") + ` ON ` + table + ` (expire)`)
+	}
+	if err != nil {
+		stor.db.Close()
+		panic("unable to create cache table: " + err.Error())
+	}
+
+	stor.q = newQueries(table)
+
+	stor.version = time.Now().UnixNano()
+
+	stor.ttlDefault = conf.TTL.Default
+	stor.ttlMax = conf.TTL.Maximum
+
+	if conf.GC.Interval > 0 {
+		stor.gc = helpers.NewInterval(conf.GC.Interval, stor.gcRun)
+		stor.gc.Start()
+	}
+
+	return stor
+}
+
+func newQueries(table string) queries {
+	const upsert = ` ON CONFLICT (key) DO UPDATE SET
+		value = excluded.value, expire = excluded.expire, version = excluded.version, tags = excluded.tags`
+
+	return queries{
+		get:      `SELECT value, expire, version FROM ` + table + ` WHERE key = ?`,
+		getMulti: `SELECT key, value, expire FROM ` + table + ` WHERE key IN `,
+		set:      `INSERT INTO ` + table + ` (key, value, expire, version, tags) VALUES (?, ?, ?, ?, ?)` + upsert,
+		add: `INSERT INTO ` + table + ` (key, value, expire, version, tags) VALUES (?, ?, ?, ?, ?)` + upsert +
+			` WHERE expire > 0 AND expire < ?`,
+		update: `UPDATE ` + table + ` SET value = ?, version = ? WHERE key = ?`,
+		compareAndSwap: `UPDATE ` + table + ` SET value = ?, expire = ?, version = ?
+			WHERE key = ? AND version = ? AND NOT (expire > 0 AND expire < ?)`,
+		delete:    `DELETE FROM ` + table + ` WHERE key = ?`,
+		deleteAll: `DELETE FROM ` + table,
+		invalidateTags: `DELETE FROM ` + table + ` WHERE tags IS NOT NULL AND EXISTS (
+			SELECT 1 FROM json_each(tags) WHERE json_each.value IN (SELECT value FROM json_each(?)))`,
+		gc: `DELETE FROM ` + table + ` WHERE expire > 0 AND expire < ?`,
+	}
+}
+
+// Close останавливает сборку мусора и закрывает базу данных.
+func (stor *Storage) Close() error {
+	if stor.gc != nil {
+		stor.gc.Stop()
+	}
+
+	return stor.db.Close()
+}
+
+func (stor *Storage) Get(key string) ([]byte, error) {
+	data, _, err := stor.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
+	return stor.SetTagged(key, data, ttl)
+}
+
+// SetTagged сохраняет данные с тегами, см. InvalidateTags.
+// Теги хранятся в строке элемента в виде массива JSON.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	tagsJSON, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = stor.db.Exec(stor.q.set, key, nonNil(data), stor.expire(ttl), stor.nextVersion(), tagsJSON)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Add сохраняет данные, только если элемент отсутствует или устарел, иначе возвращает storage.ErrExists.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	res, err := stor.db.Exec(stor.q.add, key, nonNil(data), stor.expire(ttl), stor.nextVersion(), nil, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrExists
+	}
+
+	return nil
+}
+
+// Increment увеличивает числовое значение элемента на delta и возвращает результат.
+// Отсутствующий элемент создаётся со значением initial + delta и временем хранения ttl,
+// время устаревания существующего элемента не изменяется.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	tx, err := stor.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		data []byte
+		exp  int64
+		ver  int64
+		n    int64
+	)
+
+	err = tx.QueryRow(stor.q.get, key).Scan(&data, &exp, &ver)
+	switch {
+	case err == sql.ErrNoRows || err == nil && expired(exp):
+		n = initial + delta
+		_, err = tx.Exec(stor.q.set, key, strconv.AppendInt(nil, n, 10), stor.expire(ttl), stor.nextVersion(), nil)
+
+	case err == nil:
+		n, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return 0, storage.ErrInvalidData
+		}
+		n += delta
+		_, err = tx.Exec(stor.q.update, strconv.AppendInt(nil, n, 10), stor.nextVersion(), key)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// Decrement уменьшает числовое значение элемента на delta, см. Increment.
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return stor.Increment(key, -delta, initial, ttl)
+}
+
+// GetVersioned возвращает данные и версию элемента для CompareAndSwap.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	data, ver, err := stor.get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, ver, nil
+}
+
+// CompareAndSwap сохраняет данные, только если версия элемента не изменилась после чтения
+// с помощью GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	ver, ok := version.(int64)
+	if !ok {
+		return storage.ErrVersionMismatch
+	}
+
+	res, err := stor.db.Exec(
+		stor.q.compareAndSwap,
+		nonNil(data), stor.expire(ttl), stor.nextVersion(), key, ver, time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var exp int64
+
+	err = stor.db.QueryRow(stor.q.get, key).Scan(new([]byte), &exp, new(int64))
+	if err == sql.ErrNoRows || err == nil && expired(exp) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return storage.ErrVersionMismatch
+}
+
+// GetMulti читает данные по нескольким ключам. Возвращает найденные данные и ошибки по ключам.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	items := make(map[string][]byte, len(keys))
+	errs := map[string]error{}
+
+	for i := 0; i < len(keys); i += maxVariables {
+		chunk := keys[i:min(i+maxVariables, len(keys))]
+
+		err := stor.getMulti(chunk, items, errs)
+		if err != nil {
+			for _, key := range chunk {
+				errs[key] = err
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := items[key]; ok {
+			atomic.AddInt64(&stor.hits, 1)
+			continue
+		}
+
+		atomic.AddInt64(&stor.misses, 1)
+		if _, ok := errs[key]; !ok {
+			errs[key] = storage.ErrNotFound
+		}
+	}
+
+	return items, errs
+}
+
+func (stor *Storage) getMulti(keys []string, items map[string][]byte, errs map[string]error) error {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+
+	placeholders := "(?" + strings.Repeat(", ?", len(keys)-1) + ")"
+
+	rows, err := stor.db.Query(stor.q.getMulti+placeholders, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key  string
+			data []byte
+			exp  int64
+		)
+
+		err := rows.Scan(&key, &data, &exp)
+		if err != nil {
+			return err
+		}
+
+		if expired(exp) {
+			errs[key] = storage.ErrExpired
+			continue
+		}
+		items[key] = data
+	}
+
+	return rows.Err()
+}
+
+// SetMulti сохраняет несколько элементов в одной транзакции и возвращает ошибки по ключам.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	errs := map[string]error{}
+
+	fail := func(err error) map[string]error {
+		for key := range items {
+			errs[key] = err
+		}
+		return errs
+	}
+
+	tx, err := stor.db.Begin()
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(stor.q.set)
+	if err != nil {
+		return fail(err)
+	}
+	defer stmt.Close()
+
+	exp := stor.expire(ttl)
+
+	for key, data := range items {
+		_, err := stmt.Exec(key, nonNil(data), exp, stor.nextVersion(), nil)
+		if err != nil {
+			errs[key] = err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fail(err)
+	}
+
+	return errs
+}
+
+func (stor *Storage) Delete(key string) error {
+	res, err := stor.db.Exec(stor.q.delete, key)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteMulti удаляет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	return storage.DeleteMulti(keys, stor.Delete)
+}
+
+// InvalidateTags удаляет все элементы, сохранённые с любым из указанных тегов.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagsJSON, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = stor.db.Exec(stor.q.invalidateTags, tagsJSON)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (stor *Storage) DeleteAll() error {
+	_, err := stor.db.Exec(stor.q.deleteAll)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (stor *Storage) Hits() int64 {
+	return atomic.LoadInt64(&stor.hits)
+}
+
+func (stor *Storage) Misses() int64 {
+	return atomic.LoadInt64(&stor.misses)
+}
+
+// get читает данные и версию элемента и учитывает попадание или промах.
+func (stor *Storage) get(key string) ([]byte, int64, error) {
+	var (
+		data []byte
+		exp  int64
+		ver  int64
+	)
+
+	err := stor.db.QueryRow(stor.q.get, key).Scan(&data, &exp, &ver)
+	if err == sql.ErrNoRows {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, 0, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if expired(exp) {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, 0, storage.ErrExpired
+	}
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	return data, ver, nil
+}
+
+func (stor *Storage) gcRun() {
+	stor.db.Exec(stor.q.gc, time.Now().Unix())
+}
+
+func (stor *Storage) expire(ttl time.Duration) int64 {
+	return storage.Expire(ttl, stor.ttlDefault, stor.ttlMax)
+}
+
+// nextVersion возвращает новую версию элемента. Начальная версия равна текущему времени,
+// поэтому после перезапуска версии не повторяются.
+func (stor *Storage) nextVersion() int64 {
+	return atomic.AddInt64(&stor.version, 1)
+}
+
+func expired(exp int64) bool {
+	return exp > 0 && exp < time.Now().Unix()
+}
+
+// encodeTags возвращает теги в виде массива JSON или nil, если тегов нет.
+func encodeTags(tags []string) (interface{}, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// nonNil заменяет nil пустым срезом: значение элемента не может быть NULL.
+func nonNil(data []byte) []byte {
+	if data == nil {
+		return []byte{}
+	}
+	return data
+}
+
+// quote экранирует имя таблицы или индекса.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,54 @@
+package tiered
+
+import (
+	"time"
+
+	"github.com/olegshs/go-tools/cache/drivers/memory"
+	"github.com/olegshs/go-tools/cache/drivers/redis"
+	"github.com/olegshs/go-tools/cache/storage"
+)
+
+const (
+	BroadcastNone  = ""
+	BroadcastRedis = "redis"
+)
+
+type Config struct {
+	storage.Config
+	L1        ConfigL1        `json:"l1"`
+	L2        string          `json:"l2"` // название хранилища второго уровня в разделе cache
+	Broadcast ConfigBroadcast `json:"broadcast"`
+}
+
+type ConfigL1 struct {
+	Size int64           `json:"size"` // максимальный размер в мегабайтах
+	TTL  time.Duration   `json:"ttl"`  // максимальное время хранения
+	GC   memory.ConfigGC `json:"gc"`
+}
+
+// ConfigBroadcast задаёт канал, через который экземпляры приложения
+// сообщают друг другу об изменениях, чтобы удалить устаревшие данные первого уровня.
+type ConfigBroadcast struct {
+	Driver  string       `json:"driver"` // BroadcastNone или BroadcastRedis
+	Redis   redis.Config `json:"redis"`
+	Channel string       `json:"channel"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Config: storage.DefaultConfig(),
+		L1: ConfigL1{
+			Size: 8,
+			TTL:  10 * time.Second,
+			GC: memory.ConfigGC{
+				Interval: 60 * time.Second,
+			},
+		},
+		L2: "",
+		Broadcast: ConfigBroadcast{
+			Driver:  BroadcastNone,
+			Redis:   redis.DefaultConfig(),
+			Channel: "cache.invalidate",
+		},
+	}
+}
@@ -0,0 +1,356 @@
+// Пакет tiered реализует двухуровневый драйвер: данные читаются из памяти приложения,
+// а при её промахе — из удалённого хранилища, например redis или memcached.
+//
+// Изменения данных передаются другим экземплярам приложения через bridge.Transport,
+// которые удаляют соответствующие данные первого уровня. Без канала оповещений данные
+// первого уровня могут устаревать на время не больше ConfigL1.TTL.
+package tiered
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/olegshs/go-tools/cache/drivers/memory"
+	"github.com/olegshs/go-tools/cache/storage"
+	"github.com/olegshs/go-tools/events/bridge"
+	"github.com/olegshs/go-tools/helpers"
+	"github.com/olegshs/go-tools/logs"
+)
+
+// Level — хранилище второго уровня.
+type Level interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data []byte, ttl time.Duration) error
+	Delete(key string) error
+	DeleteAll() error
+	GetMulti(keys []string) (map[string][]byte, map[string]error)
+	SetMulti(items map[string][]byte, ttl time.Duration) map[string]error
+	DeleteMulti(keys []string) map[string]error
+	Add(key string, data []byte, ttl time.Duration) error
+	Increment(key string, delta, initial int64, ttl time.Duration) (int64, error)
+	Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error)
+	GetVersioned(key string) ([]byte, storage.Version, error)
+	CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error
+	Hits() int64
+	Misses() int64
+}
+
+type taggedLevel interface {
+	SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error
+	InvalidateTags(tags ...string) error
+}
+
+type Storage struct {
+	l1    *memory.Storage
+	l1TTL time.Duration
+	l2    Level
+
+	node      string
+	transport bridge.Transport
+	channel   string
+	cancel    context.CancelFunc
+
+	hits   int64
+	misses int64
+}
+
+// Оповещение об изменении данных.
+type message struct {
+	Node string   `json:"node"`
+	Keys []string `json:"keys,omitempty"`
+	All  bool     `json:"all,omitempty"`
+}
+
+// NewStorage создаёт двухуровневое хранилище. Если transport равен nil,
+// то другие экземпляры приложения не оповещаются об изменениях.
+func NewStorage(conf Config, l2 Level, transport bridge.Transport) *Storage {
+	l1conf := memory.DefaultConfig()
+	l1conf.TTL = conf.TTL
+	l1conf.Size = conf.L1.Size
+	l1conf.GC = conf.L1.GC
+
+	stor := new(Storage)
+	stor.l1 = memory.NewStorage(l1conf)
+	stor.l1TTL = conf.L1.TTL
+	stor.l2 = l2
+
+	stor.node = helpers.RandHex(16)
+	stor.transport = transport
+	stor.channel = conf.Broadcast.Channel
+
+	if transport != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := transport.Subscribe(ctx, stor.channel, stor.receive)
+		if err != nil {
+			logs.Error("tiered.Storage:", err)
+		}
+
+		stor.cancel = cancel
+	}
+
+	return stor
+}
+
+func (stor *Storage) Get(key string) ([]byte, error) {
+	data, err := stor.l1.Get(key)
+	if err == nil {
+		atomic.AddInt64(&stor.hits, 1)
+		return data, nil
+	}
+
+	data, err = stor.l2.Get(key)
+	if err != nil {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, err
+	}
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	stor.l1.Set(key, data, stor.l1TTL)
+
+	return data, nil
+}
+
+func (stor *Storage) Set(key string, data []byte, ttl time.Duration) error {
+	err := stor.l2.Set(key, data, ttl)
+	stor.changed(key)
+	if err != nil {
+		return err
+	}
+
+	stor.l1.Set(key, data, stor.ttl(ttl))
+
+	return nil
+}
+
+// GetMulti читает данные по нескольким ключам. Отсутствующие в памяти данные
+// читаются из хранилища второго уровня одним пакетным запросом.
+func (stor *Storage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	items, errs := stor.l1.GetMulti(keys)
+
+	missing := make([]string, 0, len(errs))
+	for _, key := range keys {
+		if _, ok := errs[key]; ok {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		atomic.AddInt64(&stor.hits, int64(len(items)))
+		return items, errs
+	}
+
+	found, errs := stor.l2.GetMulti(missing)
+	for key, data := range found {
+		items[key] = data
+		stor.l1.Set(key, data, stor.l1TTL)
+	}
+
+	atomic.AddInt64(&stor.hits, int64(len(items)))
+	atomic.AddInt64(&stor.misses, int64(len(errs)))
+
+	return items, errs
+}
+
+// SetMulti сохраняет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	errs := stor.l2.SetMulti(items, ttl)
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	stor.changed(keys...)
+
+	for key, data := range items {
+		if _, ok := errs[key]; !ok {
+			stor.l1.Set(key, data, stor.ttl(ttl))
+		}
+	}
+
+	return errs
+}
+
+// Add сохраняет данные, только если элемент отсутствует в хранилище второго уровня.
+func (stor *Storage) Add(key string, data []byte, ttl time.Duration) error {
+	err := stor.l2.Add(key, data, ttl)
+	if err != nil {
+		return err
+	}
+
+	stor.changed(key)
+
+	return nil
+}
+
+// Increment изменяет счётчик в хранилище второго уровня.
+// Значения счётчиков не сохраняются в памяти, так как изменяются при каждом обращении.
+func (stor *Storage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	n, err := stor.l2.Increment(key, delta, initial, ttl)
+	stor.changed(key)
+
+	return n, err
+}
+
+func (stor *Storage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	n, err := stor.l2.Decrement(key, delta, initial, ttl)
+	stor.changed(key)
+
+	return n, err
+}
+
+// GetVersioned читает данные и версию из хранилища второго уровня.
+func (stor *Storage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	data, version, err := stor.l2.GetVersioned(key)
+	if err != nil {
+		atomic.AddInt64(&stor.misses, 1)
+		return nil, nil, err
+	}
+
+	atomic.AddInt64(&stor.hits, 1)
+
+	return data, version, nil
+}
+
+func (stor *Storage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	err := stor.l2.CompareAndSwap(key, data, version, ttl)
+	if err != nil {
+		return err
+	}
+
+	stor.changed(key)
+
+	return nil
+}
+
+// SetTagged сохраняет данные с тегами, если хранилище второго уровня поддерживает теги.
+func (stor *Storage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	tagged, ok := stor.l2.(taggedLevel)
+	if !ok {
+		return storage.ErrTagsNotSupported
+	}
+
+	err := tagged.SetTagged(key, data, ttl, tags...)
+	stor.changed(key)
+	if err != nil {
+		return err
+	}
+
+	stor.l1.Set(key, data, stor.ttl(ttl))
+
+	return nil
+}
+
+// InvalidateTags удаляет элементы с указанными тегами из хранилища второго уровня.
+// Данные первого уровня загружаются без тегов, поэтому удаляются полностью.
+func (stor *Storage) InvalidateTags(tags ...string) error {
+	tagged, ok := stor.l2.(taggedLevel)
+	if !ok {
+		return storage.ErrTagsNotSupported
+	}
+
+	err := tagged.InvalidateTags(tags...)
+	stor.l1.DeleteAll()
+	stor.publish(message{All: true})
+
+	return err
+}
+
+func (stor *Storage) Delete(key string) error {
+	err := stor.l2.Delete(key)
+	stor.changed(key)
+
+	return err
+}
+
+// DeleteMulti удаляет несколько элементов и возвращает ошибки по ключам.
+func (stor *Storage) DeleteMulti(keys []string) map[string]error {
+	errs := stor.l2.DeleteMulti(keys)
+	stor.changed(keys...)
+
+	return errs
+}
+
+func (stor *Storage) DeleteAll() error {
+	err := stor.l2.DeleteAll()
+	stor.l1.DeleteAll()
+	stor.publish(message{All: true})
+
+	return err
+}
+
+func (stor *Storage) Hits() int64 {
+	return atomic.LoadInt64(&stor.hits)
+}
+
+func (stor *Storage) Misses() int64 {
+	return atomic.LoadInt64(&stor.misses)
+}
+
+// Evictions возвращает количество элементов, вытесненных из первого уровня.
+func (stor *Storage) Evictions() int64 {
+	return stor.l1.Evictions()
+}
+
+// Close прекращает приём оповещений.
+func (stor *Storage) Close() {
+	if stor.cancel != nil {
+		stor.cancel()
+	}
+}
+
+// ttl возвращает время хранения данных первого уровня.
+func (stor *Storage) ttl(ttl time.Duration) time.Duration {
+	if ttl > 0 && (stor.l1TTL <= 0 || ttl < stor.l1TTL) {
+		return ttl
+	}
+
+	return stor.l1TTL
+}
+
+func (stor *Storage) changed(keys ...string) {
+	for _, key := range keys {
+		stor.l1.Delete(key)
+	}
+	stor.publish(message{Keys: keys})
+}
+
+func (stor *Storage) publish(m message) {
+	if stor.transport == nil {
+		return
+	}
+
+	m.Node = stor.node
+
+	data, err := json.Marshal(m)
+	if err == nil {
+		err = stor.transport.Publish(stor.channel, data)
+	}
+	if err != nil {
+		logs.Error("tiered.Storage:", err)
+	}
+}
+
+func (stor *Storage) receive(data []byte) {
+	m := message{}
+
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		logs.Error("tiered.Storage:", err)
+		return
+	}
+
+	if m.Node == stor.node {
+		return
+	}
+
+	if m.All {
+		stor.l1.DeleteAll()
+	}
+	for _, key := range m.Keys {
+		stor.l1.Delete(key)
+	}
+}
@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
+)
+
+var (
+	ErrNoEncryptionKey      = errors.New("cache encryption key is not set")
+	ErrInvalidEncryptionKey = errors.New("invalid cache encryption key: must be 16, 24 or 32 bytes in base64")
+	ErrDecrypt              = errors.New("unable to decrypt cache value")
+)
+
+const (
+	// encryptionKeyIDSize — длина идентификатора ключа в начале зашифрованных данных.
+	encryptionKeyIDSize = 4
+)
+
+// EncryptedStorage шифрует данные хранилища алгоритмом AES-GCM. Ключ элемента используется
+// как дополнительные данные шифрования, поэтому данные нельзя перенести под другой ключ.
+//
+// Данные шифруются первым ключом набора, а расшифровываются ключом, идентификатор которого
+// записан перед данными, что позволяет заменять ключи без потери сохранённых данных.
+// Если задан ключ HMAC, то ключи элементов и теги заменяются значениями HMAC-SHA256;
+// при замене ключа HMAC сохранённые данные становятся недоступны.
+//
+// Значения счётчиков Increment и Decrement не шифруются.
+type EncryptedStorage struct {
+	storage StorageInterface
+	ciphers []encryptionCipher
+	hmacKey []byte
+}
+
+type encryptionCipher struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// NewEncryptedStorage создаёт хранилище, которое шифрует данные хранилища stor.
+func NewEncryptedStorage(stor StorageInterface, conf storage.ConfigEncryption) (*EncryptedStorage, error) {
+	if len(conf.Keys) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+
+	enc := new(EncryptedStorage)
+	enc.storage = stor
+
+	for _, s := range conf.Keys {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, ErrInvalidEncryptionKey
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, ErrInvalidEncryptionKey
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(key)
+		enc.ciphers = append(enc.ciphers, encryptionCipher{sum[:encryptionKeyIDSize], aead})
+	}
+
+	if conf.HMACKey != "" {
+		key, err := base64.StdEncoding.DecodeString(conf.HMACKey)
+		if err != nil || len(key) == 0 {
+			return nil, ErrInvalidEncryptionKey
+		}
+		enc.hmacKey = key
+	}
+
+	return enc, nil
+}
+
+func (enc *EncryptedStorage) Get(key string) ([]byte, error) {
+	data, err := enc.storage.Get(enc.key(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.decrypt(key, data)
+}
+
+func (enc *EncryptedStorage) Set(key string, data []byte, ttl time.Duration) error {
+	data, err := enc.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return enc.storage.Set(enc.key(key), data, ttl)
+}
+
+func (enc *EncryptedStorage) Delete(key string) error {
+	return enc.storage.Delete(enc.key(key))
+}
+
+func (enc *EncryptedStorage) DeleteAll() error {
+	return enc.storage.DeleteAll()
+}
+
+func (enc *EncryptedStorage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	tagged, ok := enc.storage.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	data, err := enc.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return tagged.SetTagged(enc.key(key), data, ttl, enc.keys(tags)...)
+}
+
+func (enc *EncryptedStorage) InvalidateTags(tags ...string) error {
+	tagged, ok := enc.storage.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	return tagged.InvalidateTags(enc.keys(tags)...)
+}
+
+func (enc *EncryptedStorage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	hashed := enc.keys(keys)
+
+	found, errs := enc.storage.GetMulti(hashed)
+
+	items := make(map[string][]byte, len(found))
+	result := map[string]error{}
+
+	for i, key := range keys {
+		if err, ok := errs[hashed[i]]; ok {
+			result[key] = err
+			continue
+		}
+
+		data, err := enc.decrypt(key, found[hashed[i]])
+		if err != nil {
+			result[key] = err
+			continue
+		}
+		items[key] = data
+	}
+
+	return items, result
+}
+
+func (enc *EncryptedStorage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	result := map[string]error{}
+
+	encrypted := make(map[string][]byte, len(items))
+	hashed := make(map[string]string, len(items))
+
+	for key, data := range items {
+		data, err := enc.encrypt(key, data)
+		if err != nil {
+			result[key] = err
+			continue
+		}
+
+		k := enc.key(key)
+		encrypted[k] = data
+		hashed[k] = key
+	}
+
+	for k, err := range enc.storage.SetMulti(encrypted, ttl) {
+		result[hashed[k]] = err
+	}
+
+	return result
+}
+
+func (enc *EncryptedStorage) DeleteMulti(keys []string) map[string]error {
+	hashed := enc.keys(keys)
+
+	errs := enc.storage.DeleteMulti(hashed)
+
+	result := map[string]error{}
+	for i, key := range keys {
+		if err, ok := errs[hashed[i]]; ok {
+			result[key] = err
+		}
+	}
+
+	return result
+}
+
+func (enc *EncryptedStorage) Add(key string, data []byte, ttl time.Duration) error {
+	data, err := enc.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return enc.storage.Add(enc.key(key), data, ttl)
+}
+
+func (enc *EncryptedStorage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return enc.storage.Increment(enc.key(key), delta, initial, ttl)
+}
+
+func (enc *EncryptedStorage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return enc.storage.Decrement(enc.key(key), delta, initial, ttl)
+}
+
+func (enc *EncryptedStorage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	data, version, err := enc.storage.GetVersioned(enc.key(key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = enc.decrypt(key, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, version, nil
+}
+
+func (enc *EncryptedStorage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	data, err := enc.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return enc.storage.CompareAndSwap(enc.key(key), data, version, ttl)
+}
+
+func (enc *EncryptedStorage) Hits() int64 {
+	return enc.storage.Hits()
+}
+
+func (enc *EncryptedStorage) Misses() int64 {
+	return enc.storage.Misses()
+}
+
+// Evictions возвращает количество вытесненных элементов, если хранилище ведёт такой учёт.
+func (enc *EncryptedStorage) Evictions() int64 {
+	if counter, ok := enc.storage.(EvictionsCounter); ok {
+		return counter.Evictions()
+	}
+	return 0
+}
+
+// Формат: идентификатор ключа, nonce, зашифрованные данные с меткой аутентификации.
+func (enc *EncryptedStorage) encrypt(key string, data []byte) ([]byte, error) {
+	c := enc.ciphers[0]
+	n := c.aead.NonceSize()
+
+	b := make([]byte, encryptionKeyIDSize+n, encryptionKeyIDSize+n+len(data)+c.aead.Overhead())
+	copy(b, c.id)
+
+	nonce := b[encryptionKeyIDSize:]
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(b, nonce, data, []byte(key)), nil
+}
+
+func (enc *EncryptedStorage) decrypt(key string, b []byte) ([]byte, error) {
+	if len(b) < encryptionKeyIDSize {
+		return nil, ErrDecrypt
+	}
+
+	for _, c := range enc.ciphers {
+		if !bytes.Equal(c.id, b[:encryptionKeyIDSize]) {
+			continue
+		}
+
+		n := c.aead.NonceSize()
+		b = b[encryptionKeyIDSize:]
+		if len(b) < n+c.aead.Overhead() {
+			return nil, ErrDecrypt
+		}
+
+		data, err := c.aead.Open(nil, b[:n], b[n:], []byte(key))
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+
+		return data, nil
+	}
+
+	return nil, ErrDecrypt
+}
+
+// key возвращает ключ элемента в хранилище.
+func (enc *EncryptedStorage) key(key string) string {
+	if enc.hmacKey == nil {
+		return key
+	}
+
+	h := hmac.New(sha256.New, enc.hmacKey)
+	h.Write([]byte(key))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (enc *EncryptedStorage) keys(keys []string) []string {
+	if enc.hmacKey == nil {
+		return keys
+	}
+
+	hashed := make([]string, len(keys))
+	for i, key := range keys {
+		hashed[i] = enc.key(key)
+	}
+
+	return hashed
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
+	"github.com/olegshs/go-tools/events"
+)
+
+// События хранилищ кэша. Они отправляются в events.Shared под именами вида "cache.<name>.<event>",
+// например "cache.default.Miss"; на все события кэша можно подписаться по шаблону "cache.**".
+const (
+	EventHit       = events.Event("Hit")       // (key string)
+	EventMiss      = events.Event("Miss")      // (key string, err error)
+	EventSet       = events.Event("Set")       // (key string, ttl time.Duration, err error)
+	EventDelete    = events.Event("Delete")    // (key string, err error)
+	EventDeleteAll = events.Event("DeleteAll") // (err error)
+
+	EventInvalidateTags = events.Event("InvalidateTags") // (tags []string, err error)
+)
+
+// EventStorage отправляет события об обращениях к хранилищу.
+type EventStorage struct {
+	StorageInterface
+	events *events.Dispatcher
+}
+
+// NewEventStorage создаёт хранилище, которое отправляет события в диспетчер d.
+func NewEventStorage(stor StorageInterface, d *events.Dispatcher) *EventStorage {
+	return &EventStorage{stor, d}
+}
+
+func (stor *EventStorage) Events() *events.Dispatcher {
+	return stor.events
+}
+
+// Evictions возвращает количество вытесненных элементов, если хранилище ведёт такой учёт.
+func (stor *EventStorage) Evictions() int64 {
+	if counter, ok := stor.StorageInterface.(EvictionsCounter); ok {
+		return counter.Evictions()
+	}
+	return 0
+}
+
+func (stor *EventStorage) Get(key string) ([]byte, error) {
+	data, err := stor.StorageInterface.Get(key)
+	if err != nil {
+		if stor.listening(EventMiss) {
+			stor.events.Dispatch(EventMiss, key, err)
+		}
+	} else if stor.listening(EventHit) {
+		stor.events.Dispatch(EventHit, key)
+	}
+
+	return data, err
+}
+
+func (stor *EventStorage) Set(key string, data []byte, ttl time.Duration) error {
+	err := stor.StorageInterface.Set(key, data, ttl)
+	if stor.listening(EventSet) {
+		stor.events.Dispatch(EventSet, key, ttl, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	items, errs := stor.StorageInterface.GetMulti(keys)
+
+	hit, miss := stor.listening(EventHit), stor.listening(EventMiss)
+	if !hit && !miss {
+		return items, errs
+	}
+
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			if miss {
+				stor.events.Dispatch(EventMiss, key, err)
+			}
+		} else if hit {
+			stor.events.Dispatch(EventHit, key)
+		}
+	}
+
+	return items, errs
+}
+
+func (stor *EventStorage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	errs := stor.StorageInterface.SetMulti(items, ttl)
+	if !stor.listening(EventSet) {
+		return errs
+	}
+
+	for key := range items {
+		stor.events.Dispatch(EventSet, key, ttl, errs[key])
+	}
+
+	return errs
+}
+
+func (stor *EventStorage) Add(key string, data []byte, ttl time.Duration) error {
+	err := stor.StorageInterface.Add(key, data, ttl)
+	if stor.listening(EventSet) {
+		stor.events.Dispatch(EventSet, key, ttl, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	data, version, err := stor.StorageInterface.GetVersioned(key)
+	if err != nil {
+		if stor.listening(EventMiss) {
+			stor.events.Dispatch(EventMiss, key, err)
+		}
+	} else if stor.listening(EventHit) {
+		stor.events.Dispatch(EventHit, key)
+	}
+
+	return data, version, err
+}
+
+func (stor *EventStorage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	err := stor.StorageInterface.CompareAndSwap(key, data, version, ttl)
+	if stor.listening(EventSet) {
+		stor.events.Dispatch(EventSet, key, ttl, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	tagged, ok := stor.StorageInterface.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	err := tagged.SetTagged(key, data, ttl, tags...)
+	if stor.listening(EventSet) {
+		stor.events.Dispatch(EventSet, key, ttl, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) InvalidateTags(tags ...string) error {
+	tagged, ok := stor.StorageInterface.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	err := tagged.InvalidateTags(tags...)
+	if stor.listening(EventInvalidateTags) {
+		stor.events.Dispatch(EventInvalidateTags, tags, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) Delete(key string) error {
+	err := stor.StorageInterface.Delete(key)
+	if stor.listening(EventDelete) {
+		stor.events.Dispatch(EventDelete, key, err)
+	}
+
+	return err
+}
+
+func (stor *EventStorage) DeleteMulti(keys []string) map[string]error {
+	errs := stor.StorageInterface.DeleteMulti(keys)
+	if !stor.listening(EventDelete) {
+		return errs
+	}
+
+	for _, key := range keys {
+		stor.events.Dispatch(EventDelete, key, errs[key])
+	}
+
+	return errs
+}
+
+func (stor *EventStorage) DeleteAll() error {
+	err := stor.StorageInterface.DeleteAll()
+	if stor.listening(EventDeleteAll) {
+		stor.events.Dispatch(EventDeleteAll, err)
+	}
+
+	return err
+}
+
+// listening сообщает, есть ли у события слушатели. Если слушателей нет, то событие
+// не отправляется, поэтому обращения к хранилищу не создают работы для диспетчера.
+func (stor *EventStorage) listening(e events.Event) bool {
+	return stor.events.Bus().HasListeners(e)
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	flightGroups      = map[string]*flightGroup{}
+	flightGroupsMutex sync.Mutex
+)
+
+// flightGroupFor возвращает группу вычислений хранилища с указанным названием.
+func flightGroupFor(name string) *flightGroup {
+	flightGroupsMutex.Lock()
+	defer flightGroupsMutex.Unlock()
+
+	g, ok := flightGroups[name]
+	if !ok {
+		g = new(flightGroup)
+		flightGroups[name] = g
+	}
+
+	return g
+}
+
+// flightGroup объединяет одновременные вычисления значения одного ключа:
+// функция выполняется один раз, остальные вызовы ожидают и получают её результат.
+type flightGroup struct {
+	calls map[string]*flightCall
+	mutex sync.Mutex
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	data  []byte
+	err   error
+}
+
+// do выполняет функцию f, если для ключа нет выполняющегося вычисления,
+// иначе ожидает завершения этого вычисления.
+func (g *flightGroup) do(key string, f func() (interface{}, []byte, error)) *flightCall {
+	c, started := g.start(key)
+	if !started {
+		<-c.done
+		return c
+	}
+
+	g.run(key, c, f)
+	return c
+}
+
+// doAsync запускает функцию f в отдельной горутине, если для ключа нет выполняющегося вычисления.
+func (g *flightGroup) doAsync(key string, f func() (interface{}, []byte, error)) {
+	c, started := g.start(key)
+	if started {
+		go g.run(key, c, f)
+	}
+}
+
+func (g *flightGroup) start(key string) (*flightCall, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+
+	return c, true
+}
+
+func (g *flightGroup) run(key string, c *flightCall, f func() (interface{}, []byte, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.value, c.data, c.err = nil, nil, fmt.Errorf("cache: panic: %v", r)
+		}
+
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+
+		close(c.done)
+	}()
+
+	c.value, c.data, c.err = f()
+}
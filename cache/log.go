@@ -37,8 +37,13 @@ func (log *Log) printStats() {
 	hits := log.storage.Hits()
 	misses := log.storage.Misses()
 
+	var evictions int64
+	if counter, ok := log.storage.(EvictionsCounter); ok {
+		evictions = counter.Evictions()
+	}
+
 	log.channel.Debug("cache:", fmt.Sprintf(
-		"hits=%d, misses=%d",
-		hits, misses,
+		"hits=%d, misses=%d, evictions=%d",
+		hits, misses, evictions,
 	))
 }
@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
+)
+
+// Операции, для которых MetricsStorage ведёт статистику.
+const (
+	OperationGet            = "get"
+	OperationSet            = "set"
+	OperationDelete         = "delete"
+	OperationDeleteAll      = "delete_all"
+	OperationGetMulti       = "get_multi"
+	OperationSetMulti       = "set_multi"
+	OperationDeleteMulti    = "delete_multi"
+	OperationAdd            = "add"
+	OperationIncrement      = "increment"
+	OperationDecrement      = "decrement"
+	OperationGetVersioned   = "get_versioned"
+	OperationCompareAndSwap = "compare_and_swap"
+	OperationSetTagged      = "set_tagged"
+	OperationInvalidateTags = "invalidate_tags"
+)
+
+var metricsOperations = []string{
+	OperationGet,
+	OperationSet,
+	OperationDelete,
+	OperationDeleteAll,
+	OperationGetMulti,
+	OperationSetMulti,
+	OperationDeleteMulti,
+	OperationAdd,
+	OperationIncrement,
+	OperationDecrement,
+	OperationGetVersioned,
+	OperationCompareAndSwap,
+	OperationSetTagged,
+	OperationInvalidateTags,
+}
+
+// MetricsStorage ведёт статистику обращений к хранилищу: количество операций и ошибок,
+// распределение длительности операций и размера данных, количество попаданий, промахов
+// и устаревших элементов. Статистика доступна через MetricsHandler.
+type MetricsStorage struct {
+	StorageInterface
+	name string
+
+	operations map[string]*operationMetrics
+
+	hits    int64
+	misses  int64
+	expired int64
+}
+
+type operationMetrics struct {
+	calls    int64
+	errors   int64
+	duration *histogram
+	size     *histogram
+}
+
+// NewMetricsStorage создаёт хранилище, которое ведёт статистику под названием name,
+// и регистрирует его в MetricsHandler вместо хранилища с тем же названием.
+func NewMetricsStorage(stor StorageInterface, name string) *MetricsStorage {
+	m := new(MetricsStorage)
+	m.StorageInterface = stor
+	m.name = name
+
+	m.operations = make(map[string]*operationMetrics, len(metricsOperations))
+	for _, op := range metricsOperations {
+		m.operations[op] = &operationMetrics{
+			duration: newHistogram(durationBuckets, float64(time.Second)),
+			size:     newHistogram(sizeBuckets, 1),
+		}
+	}
+
+	registerMetrics(m)
+
+	return m
+}
+
+// Name возвращает название хранилища в статистике.
+func (m *MetricsStorage) Name() string {
+	return m.name
+}
+
+// Evictions возвращает количество вытесненных элементов, если хранилище ведёт такой учёт.
+func (m *MetricsStorage) Evictions() int64 {
+	if counter, ok := m.StorageInterface.(EvictionsCounter); ok {
+		return counter.Evictions()
+	}
+	return 0
+}
+
+func (m *MetricsStorage) Get(key string) ([]byte, error) {
+	start := time.Now()
+	data, err := m.StorageInterface.Get(key)
+	m.done(OperationGet, start, err)
+
+	m.read(OperationGet, data, err)
+
+	return data, err
+}
+
+func (m *MetricsStorage) Set(key string, data []byte, ttl time.Duration) error {
+	start := time.Now()
+	err := m.StorageInterface.Set(key, data, ttl)
+	m.done(OperationSet, start, err)
+
+	m.observeSize(OperationSet, data)
+
+	return err
+}
+
+func (m *MetricsStorage) Delete(key string) error {
+	start := time.Now()
+	err := m.StorageInterface.Delete(key)
+	m.done(OperationDelete, start, err)
+
+	return err
+}
+
+func (m *MetricsStorage) DeleteAll() error {
+	start := time.Now()
+	err := m.StorageInterface.DeleteAll()
+	m.done(OperationDeleteAll, start, err)
+
+	return err
+}
+
+func (m *MetricsStorage) GetMulti(keys []string) (map[string][]byte, map[string]error) {
+	start := time.Now()
+	items, errs := m.StorageInterface.GetMulti(keys)
+	m.done(OperationGetMulti, start, firstError(errs))
+
+	for _, key := range keys {
+		m.read(OperationGetMulti, items[key], errs[key])
+	}
+
+	return items, errs
+}
+
+func (m *MetricsStorage) SetMulti(items map[string][]byte, ttl time.Duration) map[string]error {
+	start := time.Now()
+	errs := m.StorageInterface.SetMulti(items, ttl)
+	m.done(OperationSetMulti, start, firstError(errs))
+
+	for _, data := range items {
+		m.observeSize(OperationSetMulti, data)
+	}
+
+	return errs
+}
+
+func (m *MetricsStorage) DeleteMulti(keys []string) map[string]error {
+	start := time.Now()
+	errs := m.StorageInterface.DeleteMulti(keys)
+	m.done(OperationDeleteMulti, start, firstError(errs))
+
+	return errs
+}
+
+func (m *MetricsStorage) Add(key string, data []byte, ttl time.Duration) error {
+	start := time.Now()
+	err := m.StorageInterface.Add(key, data, ttl)
+	m.done(OperationAdd, start, err)
+
+	m.observeSize(OperationAdd, data)
+
+	return err
+}
+
+func (m *MetricsStorage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := m.StorageInterface.Increment(key, delta, initial, ttl)
+	m.done(OperationIncrement, start, err)
+
+	return n, err
+}
+
+func (m *MetricsStorage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := m.StorageInterface.Decrement(key, delta, initial, ttl)
+	m.done(OperationDecrement, start, err)
+
+	return n, err
+}
+
+func (m *MetricsStorage) GetVersioned(key string) ([]byte, storage.Version, error) {
+	start := time.Now()
+	data, version, err := m.StorageInterface.GetVersioned(key)
+	m.done(OperationGetVersioned, start, err)
+
+	m.read(OperationGetVersioned, data, err)
+
+	return data, version, err
+}
+
+func (m *MetricsStorage) CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error {
+	start := time.Now()
+	err := m.StorageInterface.CompareAndSwap(key, data, version, ttl)
+	m.done(OperationCompareAndSwap, start, err)
+
+	m.observeSize(OperationCompareAndSwap, data)
+
+	return err
+}
+
+func (m *MetricsStorage) SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error {
+	tagged, ok := m.StorageInterface.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	start := time.Now()
+	err := tagged.SetTagged(key, data, ttl, tags...)
+	m.done(OperationSetTagged, start, err)
+
+	m.observeSize(OperationSetTagged, data)
+
+	return err
+}
+
+func (m *MetricsStorage) InvalidateTags(tags ...string) error {
+	tagged, ok := m.StorageInterface.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	start := time.Now()
+	err := tagged.InvalidateTags(tags...)
+	m.done(OperationInvalidateTags, start, err)
+
+	return err
+}
+
+// done учитывает выполненную операцию. Отсутствие элемента и другие ожидаемые
+// результаты атомарных операций не считаются ошибками.
+func (m *MetricsStorage) done(op string, start time.Time, err error) {
+	o := m.operations[op]
+
+	atomic.AddInt64(&o.calls, 1)
+	o.duration.observe(int64(time.Since(start)))
+
+	switch err {
+	case nil, storage.ErrNotFound, storage.ErrExpired, storage.ErrExists, storage.ErrVersionMismatch:
+	default:
+		atomic.AddInt64(&o.errors, 1)
+	}
+}
+
+// read учитывает результат чтения одного элемента.
+func (m *MetricsStorage) read(op string, data []byte, err error) {
+	switch err {
+	case nil:
+		atomic.AddInt64(&m.hits, 1)
+		m.observeSize(op, data)
+	case storage.ErrExpired:
+		atomic.AddInt64(&m.expired, 1)
+		atomic.AddInt64(&m.misses, 1)
+	case storage.ErrNotFound:
+		atomic.AddInt64(&m.misses, 1)
+	}
+}
+
+func (m *MetricsStorage) observeSize(op string, data []byte) {
+	m.operations[op].size.observe(int64(len(data)))
+}
+
+func firstError(errs map[string]error) error {
+	for _, err := range errs {
+		if err != storage.ErrNotFound && err != storage.ErrExpired {
+			return err
+		}
+	}
+	return nil
+}
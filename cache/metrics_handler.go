@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Границы интервалов распределения длительности операций.
+	durationBuckets = []int64{
+		int64(100 * time.Microsecond),
+		int64(500 * time.Microsecond),
+		int64(time.Millisecond),
+		int64(5 * time.Millisecond),
+		int64(10 * time.Millisecond),
+		int64(50 * time.Millisecond),
+		int64(100 * time.Millisecond),
+		int64(500 * time.Millisecond),
+		int64(time.Second),
+	}
+
+	// Границы интервалов распределения размера данных в байтах.
+	sizeBuckets = []int64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+)
+
+var (
+	metricsStorages      = map[string]*MetricsStorage{}
+	metricsStoragesMutex sync.Mutex
+)
+
+// MetricsHandler возвращает обработчик, который выводит статистику всех хранилищ
+// в текстовом формате Prometheus, например:
+//
+//	r.Get("/metrics").Handle(cache.MetricsHandler())
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+}
+
+// WriteMetrics выводит статистику всех хранилищ в текстовом формате Prometheus.
+func WriteMetrics(w io.Writer) error {
+	storages := registeredMetrics()
+
+	b := bufio.NewWriter(w)
+
+	writeFamily(b, "cache_operations_total", "counter", "Number of cache operations.")
+	for _, m := range storages {
+		m.eachOperation(func(op string, o *operationMetrics) {
+			writeSample(b, "cache_operations_total", labels(m.name, op), atomic.LoadInt64(&o.calls))
+		})
+	}
+
+	writeFamily(b, "cache_errors_total", "counter", "Number of failed cache operations.")
+	for _, m := range storages {
+		m.eachOperation(func(op string, o *operationMetrics) {
+			writeSample(b, "cache_errors_total", labels(m.name, op), atomic.LoadInt64(&o.errors))
+		})
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(m *MetricsStorage) int64
+	}{
+		{"cache_hits_total", "Number of cache hits.", func(m *MetricsStorage) int64 {
+			return atomic.LoadInt64(&m.hits)
+		}},
+		{"cache_misses_total", "Number of cache misses.", func(m *MetricsStorage) int64 {
+			return atomic.LoadInt64(&m.misses)
+		}},
+		{"cache_expired_total", "Number of reads of expired items.", func(m *MetricsStorage) int64 {
+			return atomic.LoadInt64(&m.expired)
+		}},
+		{"cache_evictions_total", "Number of items evicted due to the size limit.", func(m *MetricsStorage) int64 {
+			return m.Evictions()
+		}},
+	}
+
+	for _, c := range counters {
+		writeFamily(b, c.name, "counter", c.help)
+		for _, m := range storages {
+			writeSample(b, c.name, labels(m.name, ""), c.value(m))
+		}
+	}
+
+	writeFamily(b, "cache_operation_duration_seconds", "histogram", "Duration of cache operations.")
+	for _, m := range storages {
+		m.eachOperation(func(op string, o *operationMetrics) {
+			o.duration.write(b, "cache_operation_duration_seconds", labels(m.name, op))
+		})
+	}
+
+	writeFamily(b, "cache_payload_bytes", "histogram", "Size of data read from and written to the cache.")
+	for _, m := range storages {
+		m.eachOperation(func(op string, o *operationMetrics) {
+			if atomic.LoadInt64(&o.size.count) > 0 {
+				o.size.write(b, "cache_payload_bytes", labels(m.name, op))
+			}
+		})
+	}
+
+	return b.Flush()
+}
+
+func registerMetrics(m *MetricsStorage) {
+	metricsStoragesMutex.Lock()
+	defer metricsStoragesMutex.Unlock()
+
+	metricsStorages[m.name] = m
+}
+
+// registeredMetrics возвращает зарегистрированные хранилища, упорядоченные по названию.
+func registeredMetrics() []*MetricsStorage {
+	metricsStoragesMutex.Lock()
+	defer metricsStoragesMutex.Unlock()
+
+	storages := make([]*MetricsStorage, 0, len(metricsStorages))
+	for _, m := range metricsStorages {
+		storages = append(storages, m)
+	}
+
+	sort.Slice(storages, func(i, j int) bool {
+		return storages[i].name < storages[j].name
+	})
+
+	return storages
+}
+
+// eachOperation перебирает операции, которые выполнялись хотя бы раз.
+func (m *MetricsStorage) eachOperation(f func(op string, o *operationMetrics)) {
+	for _, op := range metricsOperations {
+		o := m.operations[op]
+		if atomic.LoadInt64(&o.calls) > 0 {
+			f(op, o)
+		}
+	}
+}
+
+// histogram — распределение значений по интервалам для вывода в формате Prometheus.
+// Значения делятся на scale при выводе, например длительность в наносекундах — на 1e9.
+type histogram struct {
+	bounds []int64
+	counts []int64
+	count  int64
+	sum    int64
+	scale  float64
+}
+
+func newHistogram(bounds []int64, scale float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)),
+		scale:  scale,
+	}
+}
+
+func (h *histogram) observe(v int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool {
+		return v <= h.bounds[i]
+	})
+	if i < len(h.counts) {
+		atomic.AddInt64(&h.counts[i], 1)
+	}
+
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+}
+
+func (h *histogram) write(w io.Writer, name string, labels string) {
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadInt64(&h.counts[i])
+		le := formatFloat(float64(bound) / h.scale)
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, cumulative)
+	}
+
+	count := atomic.LoadInt64(&h.count)
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(float64(atomic.LoadInt64(&h.sum))/h.scale))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, count)
+}
+
+func writeFamily(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(w io.Writer, name string, labels string, value int64) {
+	fmt.Fprintf(w, "%s{%s} %d\n", name, labels, value)
+}
+
+func labels(storage, operation string) string {
+	s := `storage="` + escapeLabel(storage) + `"`
+	if operation != "" {
+		s += `,operation="` + operation + `"`
+	}
+	return s
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -1,10 +1,11 @@
 package cache
 
 import (
-	"bytes"
-	"encoding/gob"
 	"errors"
 	"time"
+
+	"github.com/olegshs/go-tools/cache/codec"
+	cachestorage "github.com/olegshs/go-tools/cache/storage"
 )
 
 var (
@@ -13,10 +14,37 @@ var (
 
 type ObjectStorage struct {
 	Storage StorageInterface
+
+	// Encoder кодирует объекты, которые не реализуют Serializer;
+	// если не задан, то используется gob без заголовка
+	Encoder *codec.Encoder
+
+	// одновременные вычисления значений в Remember: хранилища, созданные ObjectStorageFor,
+	// используют общую группу для каждого названия хранилища, остальные — собственную
+	flight    *flightGroup
+	ownFlight flightGroup
 }
 
+var (
+	defaultEncoder = codec.NewEncoder(codec.DefaultConfig())
+)
+
 func ObjectStorageFor(name string) *ObjectStorage {
-	return &ObjectStorage{Storage(name)}
+	conf := cachestorage.DefaultConfig()
+	getStorageConfig(name, &conf)
+
+	return &ObjectStorage{
+		Storage: Storage(name),
+		Encoder: codec.NewEncoder(conf.Codec),
+		flight:  flightGroupFor(name),
+	}
+}
+
+func (storage *ObjectStorage) flights() *flightGroup {
+	if storage.flight != nil {
+		return storage.flight
+	}
+	return &storage.ownFlight
 }
 
 func (storage *ObjectStorage) Get(key string, obj interface{}) error {
@@ -30,46 +58,18 @@ func (storage *ObjectStorage) Get(key string, obj interface{}) error {
 		return ErrEmptyObject
 	}
 
-	switch t := obj.(type) {
-	case Deserializer:
-		err := t.Deserialize(data)
-		if err != nil {
-			return err
-		}
-	default:
-		dec := gob.NewDecoder(bytes.NewBuffer(data))
-		err := dec.Decode(obj)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return storage.decode(data, obj)
 }
 
 func (storage *ObjectStorage) Set(key string, obj interface{}, ttl time.Duration) error {
-	buf := new(bytes.Buffer)
-
-	switch t := obj.(type) {
-	case Serializer:
-		data, err := t.Serialize()
-		if err != nil {
-			return err
-		}
-		buf.Write(data)
-	case nil:
-		// empty
-	default:
-		enc := gob.NewEncoder(buf)
-		err := enc.Encode(obj)
-		if err != nil {
-			return err
-		}
+	data, err := storage.encode(obj)
+	if err != nil {
+		return err
 	}
 
 	key = objectStorageKey(key)
 
-	err := storage.Storage.Set(key, buf.Bytes(), ttl)
+	err = storage.Storage.Set(key, data, ttl)
 	if err != nil {
 		return err
 	}
@@ -77,6 +77,28 @@ func (storage *ObjectStorage) Set(key string, obj interface{}, ttl time.Duration
 	return nil
 }
 
+// SetTagged сохраняет объект с тегами. Хранилище должно реализовывать TaggedStorageInterface.
+func (storage *ObjectStorage) SetTagged(key string, obj interface{}, ttl time.Duration, tags ...string) error {
+	data, err := storage.encode(obj)
+	if err != nil {
+		return err
+	}
+
+	key = objectStorageKey(key)
+
+	return storage.setTagged(key, data, ttl, tags)
+}
+
+// InvalidateTags удаляет все объекты, сохранённые с любым из указанных тегов.
+func (storage *ObjectStorage) InvalidateTags(tags ...string) error {
+	tagged, ok := storage.Storage.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	return tagged.InvalidateTags(tags...)
+}
+
 func (storage *ObjectStorage) Delete(key string) error {
 	key = objectStorageKey(key)
 
@@ -88,6 +110,185 @@ func (storage *ObjectStorage) Delete(key string) error {
 	return nil
 }
 
+// Add сохраняет объект, только если он отсутствует, иначе возвращает storage.ErrExists.
+func (storage *ObjectStorage) Add(key string, obj interface{}, ttl time.Duration) error {
+	data, err := storage.encode(obj)
+	if err != nil {
+		return err
+	}
+
+	key = objectStorageKey(key)
+
+	return storage.Storage.Add(key, data, ttl)
+}
+
+// Increment атомарно увеличивает счётчик на delta и возвращает результат. Отсутствующий счётчик
+// создаётся со значением initial + delta и временем хранения ttl. Счётчики хранятся отдельно
+// от объектов, текущее значение можно получить вызовом Increment с нулевым delta.
+func (storage *ObjectStorage) Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return storage.Storage.Increment(counterStorageKey(key), delta, initial, ttl)
+}
+
+// Decrement атомарно уменьшает счётчик на delta, см. Increment.
+func (storage *ObjectStorage) Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return storage.Storage.Decrement(counterStorageKey(key), delta, initial, ttl)
+}
+
+// GetVersioned читает объект и возвращает его версию для CompareAndSwap.
+func (storage *ObjectStorage) GetVersioned(key string, obj interface{}) (cachestorage.Version, error) {
+	key = objectStorageKey(key)
+
+	data, version, err := storage.Storage.GetVersioned(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyObject
+	}
+
+	err = storage.decode(data, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// CompareAndSwap сохраняет объект, только если он не изменился после чтения с помощью
+// GetVersioned, иначе возвращает storage.ErrVersionMismatch.
+func (storage *ObjectStorage) CompareAndSwap(key string, obj interface{}, version cachestorage.Version, ttl time.Duration) error {
+	data, err := storage.encode(obj)
+	if err != nil {
+		return err
+	}
+
+	key = objectStorageKey(key)
+
+	return storage.Storage.CompareAndSwap(key, data, version, ttl)
+}
+
+// GetMulti читает объекты по ключам карты objs в соответствующие им значения,
+// которые должны быть указателями. Возвращает ошибки по ключам.
+func (storage *ObjectStorage) GetMulti(objs map[string]interface{}) map[string]error {
+	keys := make([]string, 0, len(objs))
+	for key := range objs {
+		keys = append(keys, objectStorageKey(key))
+	}
+
+	items, errs := storage.Storage.GetMulti(keys)
+
+	result := map[string]error{}
+	for key, obj := range objs {
+		k := objectStorageKey(key)
+
+		if err, ok := errs[k]; ok {
+			result[key] = err
+			continue
+		}
+
+		data := items[k]
+		if len(data) == 0 {
+			result[key] = ErrEmptyObject
+			continue
+		}
+
+		err := storage.decode(data, obj)
+		if err != nil {
+			result[key] = err
+		}
+	}
+
+	return result
+}
+
+// SetMulti сохраняет объекты карты objs под соответствующими ключами. Возвращает ошибки по ключам.
+func (storage *ObjectStorage) SetMulti(objs map[string]interface{}, ttl time.Duration) map[string]error {
+	result := map[string]error{}
+
+	items := make(map[string][]byte, len(objs))
+	for key, obj := range objs {
+		data, err := storage.encode(obj)
+		if err != nil {
+			result[key] = err
+			continue
+		}
+		items[objectStorageKey(key)] = data
+	}
+
+	errs := storage.Storage.SetMulti(items, ttl)
+	for key := range objs {
+		if err, ok := errs[objectStorageKey(key)]; ok {
+			result[key] = err
+		}
+	}
+
+	return result
+}
+
+// DeleteMulti удаляет объекты по ключам. Возвращает ошибки по ключам.
+func (storage *ObjectStorage) DeleteMulti(keys []string) map[string]error {
+	objectKeys := make([]string, len(keys))
+	for i, key := range keys {
+		objectKeys[i] = objectStorageKey(key)
+	}
+
+	errs := storage.Storage.DeleteMulti(objectKeys)
+
+	result := map[string]error{}
+	for i, key := range keys {
+		if err, ok := errs[objectKeys[i]]; ok {
+			result[key] = err
+		}
+	}
+
+	return result
+}
+
+func (storage *ObjectStorage) setTagged(key string, data []byte, ttl time.Duration, tags []string) error {
+	if len(tags) == 0 {
+		return storage.Storage.Set(key, data, ttl)
+	}
+
+	tagged, ok := storage.Storage.(TaggedStorageInterface)
+	if !ok {
+		return ErrTagsNotSupported
+	}
+
+	return tagged.SetTagged(key, data, ttl, tags...)
+}
+
 func objectStorageKey(key string) string {
 	return key + ".(obj)"
 }
+
+func counterStorageKey(key string) string {
+	return key + ".(counter)"
+}
+
+// encode кодирует объект методом Serialize или кодеком хранилища.
+func (storage *ObjectStorage) encode(obj interface{}) ([]byte, error) {
+	switch t := obj.(type) {
+	case Serializer:
+		return t.Serialize()
+	case nil:
+		return nil, nil
+	default:
+		return storage.encoder().Encode(obj)
+	}
+}
+
+// decode декодирует объект методом Deserialize или кодеком, указанным в заголовке данных.
+func (storage *ObjectStorage) decode(data []byte, obj interface{}) error {
+	if t, ok := obj.(Deserializer); ok {
+		return t.Deserialize(data)
+	}
+
+	return codec.Decode(data, obj)
+}
+
+func (storage *ObjectStorage) encoder() *codec.Encoder {
+	if storage.Encoder == nil {
+		return defaultEncoder
+	}
+	return storage.Encoder
+}
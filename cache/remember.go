@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/olegshs/go-tools/logs"
+)
+
+// Заголовок значения, сохранённого функцией Remember: время устаревания
+// и длительность вычисления в миллисекундах.
+const (
+	rememberHeaderSize = 16
+)
+
+// RememberOption задаёт параметры Remember.
+type RememberOption func(o *rememberOptions)
+
+type rememberOptions struct {
+	stale time.Duration
+	beta  float64
+	tags  []string
+}
+
+// StaleWhileRevalidate разрешает в течение d после устаревания значения возвращать
+// устаревшее значение, пока новое вычисляется в отдельной горутине.
+// Действует только при ttl больше нуля.
+func StaleWhileRevalidate(d time.Duration) RememberOption {
+	return func(o *rememberOptions) {
+		o.stale = d
+	}
+}
+
+// EarlyExpiration включает вероятностное обновление значения до его устаревания.
+// Вероятность растёт по мере приближения к моменту устаревания и с увеличением
+// длительности вычисления; beta = 1 подходит в большинстве случаев, большие значения
+// приводят к более раннему обновлению. Значение обновляется в отдельной горутине.
+// Действует только при ttl больше нуля.
+func EarlyExpiration(beta float64) RememberOption {
+	return func(o *rememberOptions) {
+		o.beta = beta
+	}
+}
+
+// WithTags сохраняет значение с тегами, см. ObjectStorage.SetTagged.
+func WithTags(tags ...string) RememberOption {
+	return func(o *rememberOptions) {
+		o.tags = tags
+	}
+}
+
+// Remember возвращает значение из кэша по умолчанию или вычисляет его функцией f
+// и сохраняет на время ttl, см. RememberIn.
+func Remember[T any](key string, ttl time.Duration, f func() (T, error), options ...RememberOption) (T, error) {
+	return RememberIn(DefaultObjectStorage(), key, ttl, f, options...)
+}
+
+// RememberIn возвращает значение из хранилища или вычисляет его функцией f и сохраняет на время ttl.
+// Одновременные вызовы с одним ключом в одном хранилище объединяются: f выполняется один раз,
+// остальные вызовы ожидают её результата. Ошибка f возвращается всем ожидающим и не сохраняется.
+//
+// Значения хранятся под отдельными ключами вместе с заголовком, поэтому их нельзя получить
+// функцией Get; для удаления используется Forget.
+func RememberIn[T any](storage *ObjectStorage, key string, ttl time.Duration, f func() (T, error), options ...RememberOption) (T, error) {
+	var v T
+
+	err := storage.remember(key, ttl, decodeTarget(&v), func(value interface{}) bool {
+		t, ok := value.(T)
+		if ok {
+			v = t
+		}
+		return ok
+	}, func() (interface{}, error) {
+		return f()
+	}, options)
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// GetOrSet получает значение obj из хранилища или вычисляет его функцией f, см. RememberIn.
+func (storage *ObjectStorage) GetOrSet(key string, obj interface{}, ttl time.Duration, f func() (interface{}, error), options ...RememberOption) error {
+	return storage.remember(key, ttl, obj, func(value interface{}) bool {
+		rv := reflect.ValueOf(obj)
+		val := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Ptr || !val.IsValid() || !val.Type().AssignableTo(rv.Type().Elem()) {
+			return false
+		}
+
+		rv.Elem().Set(val)
+		return true
+	}, f, options)
+}
+
+// Forget удаляет значение, сохранённое функцией Remember или GetOrSet.
+func (storage *ObjectStorage) Forget(key string) error {
+	return storage.Storage.Delete(rememberKey(key))
+}
+
+// remember заполняет obj значением из хранилища. Вычисленное значение передаётся
+// в функцию assign, а если её тип не подходит — декодируется в obj.
+func (storage *ObjectStorage) remember(
+	key string, ttl time.Duration, obj interface{},
+	assign func(value interface{}) bool,
+	f func() (interface{}, error),
+	options []RememberOption,
+) error {
+	o := rememberOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+
+	key = rememberKey(key)
+	compute := storage.compute(key, ttl, o, f)
+	refresh := func() (interface{}, []byte, error) {
+		value, data, err := compute()
+		if err != nil {
+			logs.Error("cache.Remember:", err)
+		}
+		return value, data, err
+	}
+
+	data, err := storage.Storage.Get(key)
+	if err == nil && len(data) >= rememberHeaderSize {
+		expire := int64(binary.BigEndian.Uint64(data[0:8]))
+		delta := int64(binary.BigEndian.Uint64(data[8:16]))
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+
+		fresh := expire == 0 || now < expire
+		stale := !fresh && now < expire+int64(o.stale/time.Millisecond)
+
+		if fresh && expire > 0 && o.beta > 0 {
+			// XFetch: чем ближе устаревание и дольше вычисление, тем вероятнее раннее обновление
+			if float64(now)-float64(delta)*o.beta*math.Log(rand.Float64()) >= float64(expire) {
+				storage.flights().doAsync(key, refresh)
+			}
+		}
+		if stale {
+			storage.flights().doAsync(key, refresh)
+		}
+
+		if fresh || stale {
+			err = storage.decode(data[rememberHeaderSize:], obj)
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	c := storage.flights().do(key, compute)
+	if c.err != nil {
+		return c.err
+	}
+
+	if !assign(c.value) {
+		return storage.decode(c.data, obj)
+	}
+
+	return nil
+}
+
+// compute возвращает функцию, которая вычисляет значение и сохраняет его в хранилище.
+// Ошибка сохранения записывается в журнал и не возвращается.
+func (storage *ObjectStorage) compute(key string, ttl time.Duration, o rememberOptions, f func() (interface{}, error)) func() (interface{}, []byte, error) {
+	return func() (interface{}, []byte, error) {
+		start := time.Now()
+
+		value, err := f()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		delta := time.Since(start)
+
+		payload, err := storage.encode(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var expire int64
+		storageTTL := ttl
+		if ttl > 0 {
+			expire = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+			storageTTL += o.stale
+		}
+
+		data := make([]byte, rememberHeaderSize, rememberHeaderSize+len(payload))
+		binary.BigEndian.PutUint64(data[0:8], uint64(expire))
+		binary.BigEndian.PutUint64(data[8:16], uint64(delta/time.Millisecond))
+		data = append(data, payload...)
+
+		err = storage.setTagged(key, data, storageTTL, o.tags)
+		if err != nil {
+			logs.Error("cache.Remember:", err)
+		}
+
+		return value, payload, nil
+	}
+}
+
+// decodeTarget возвращает значение, в которое декодируются данные для v.
+// Для указателей создаётся новый объект, чтобы учитывался Deserializer.
+func decodeTarget[T any](v *T) interface{} {
+	rv := reflect.ValueOf(v).Elem()
+	if rv.Kind() == reflect.Ptr {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		return rv.Interface()
+	}
+
+	return v
+}
+
+func rememberKey(key string) string {
+	return key + ".(remember)"
+}
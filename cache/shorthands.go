@@ -1,17 +1,21 @@
 package cache
 
 import (
+	"sync"
 	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
 )
 
 var (
-	defaultObjectStorage *ObjectStorage
+	defaultObjectStorage     *ObjectStorage
+	defaultObjectStorageOnce sync.Once
 )
 
 func DefaultObjectStorage() *ObjectStorage {
-	if defaultObjectStorage == nil {
+	defaultObjectStorageOnce.Do(func() {
 		defaultObjectStorage = ObjectStorageFor(DefaultStorage)
-	}
+	})
 	return defaultObjectStorage
 }
 
@@ -23,6 +27,54 @@ func Set(key string, obj interface{}, ttl time.Duration) error {
 	return DefaultObjectStorage().Set(key, obj, ttl)
 }
 
+func SetTagged(key string, obj interface{}, ttl time.Duration, tags ...string) error {
+	return DefaultObjectStorage().SetTagged(key, obj, ttl, tags...)
+}
+
+func InvalidateTags(tags ...string) error {
+	return DefaultObjectStorage().InvalidateTags(tags...)
+}
+
 func Delete(key string) error {
 	return DefaultObjectStorage().Delete(key)
 }
+
+func Add(key string, obj interface{}, ttl time.Duration) error {
+	return DefaultObjectStorage().Add(key, obj, ttl)
+}
+
+func Increment(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return DefaultObjectStorage().Increment(key, delta, initial, ttl)
+}
+
+func Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error) {
+	return DefaultObjectStorage().Decrement(key, delta, initial, ttl)
+}
+
+func GetVersioned(key string, obj interface{}) (storage.Version, error) {
+	return DefaultObjectStorage().GetVersioned(key, obj)
+}
+
+func CompareAndSwap(key string, obj interface{}, version storage.Version, ttl time.Duration) error {
+	return DefaultObjectStorage().CompareAndSwap(key, obj, version, ttl)
+}
+
+func GetMulti(objs map[string]interface{}) map[string]error {
+	return DefaultObjectStorage().GetMulti(objs)
+}
+
+func SetMulti(objs map[string]interface{}, ttl time.Duration) map[string]error {
+	return DefaultObjectStorage().SetMulti(objs, ttl)
+}
+
+func DeleteMulti(keys []string) map[string]error {
+	return DefaultObjectStorage().DeleteMulti(keys)
+}
+
+func GetOrSet(key string, obj interface{}, ttl time.Duration, f func() (interface{}, error), options ...RememberOption) error {
+	return DefaultObjectStorage().GetOrSet(key, obj, ttl, f, options...)
+}
+
+func Forget(key string) error {
+	return DefaultObjectStorage().Forget(key)
+}
@@ -11,8 +11,11 @@ import (
 	"github.com/olegshs/go-tools/cache/drivers/memcached"
 	"github.com/olegshs/go-tools/cache/drivers/memory"
 	"github.com/olegshs/go-tools/cache/drivers/redis"
+	"github.com/olegshs/go-tools/cache/drivers/tiered"
 	"github.com/olegshs/go-tools/cache/storage"
 	"github.com/olegshs/go-tools/config"
+	"github.com/olegshs/go-tools/events"
+	"github.com/olegshs/go-tools/events/bridge"
 )
 
 const (
@@ -23,6 +26,8 @@ const (
 	DriverMemory    = "memory"
 	DriverMemcached = "memcached"
 	DriverRedis     = "redis"
+	DriverSqlite    = "sqlite" // доступен при сборке с тегом sqlite, так как требует cgo
+	DriverTiered    = "tiered"
 
 	DefaultTTL = storage.DefaultTTL
 	MaximumTTL = storage.MaximumTTL
@@ -31,6 +36,9 @@ const (
 var (
 	storageInstances      = map[string]StorageInterface{}
 	storageInstancesMutex sync.Mutex
+
+	// драйверы, которые подключаются при сборке с тегами, например DriverSqlite
+	optionalDrivers = map[string]func(name string) StorageInterface{}
 )
 
 func Storage(name string) StorageInterface {
@@ -53,6 +61,13 @@ func newStorage(name string) StorageInterface {
 	getStorageConfig(name, &conf)
 
 	stor := newStorageByDriver(conf.Driver, name)
+	stor = newEncryptedStorage(stor, conf.Encryption)
+
+	if conf.Metrics.Enabled {
+		stor = NewMetricsStorage(stor, name)
+	}
+
+	stor = NewEventStorage(stor, events.Shared.Namespace("cache."+name))
 
 	if conf.Log.Enabled {
 		log := NewLog(stor, conf.Log)
@@ -90,11 +105,54 @@ func newStorageByDriver(driver string, name string) StorageInterface {
 		conf.Prefix = addPrefix(conf.Prefix, name)
 		return redis.NewStorage(conf)
 
+	case DriverTiered:
+		conf := tiered.DefaultConfig()
+		getStorageConfig(name, &conf)
+		return newTieredStorage(name, conf)
+
 	default:
+		if f, ok := optionalDrivers[driver]; ok {
+			return f(name)
+		}
 		panic("invalid cache driver: " + driver)
 	}
 }
 
+func newTieredStorage(name string, conf tiered.Config) StorageInterface {
+	l2conf := storage.DefaultConfig()
+	exists := getStorageConfig(conf.L2, &l2conf)
+	if !exists || conf.L2 == name || l2conf.Driver == DriverTiered {
+		panic("invalid tiered cache level: " + conf.L2)
+	}
+
+	l2 := newStorageByDriver(l2conf.Driver, conf.L2)
+	l2 = newEncryptedStorage(l2, l2conf.Encryption)
+
+	var transport bridge.Transport
+	switch conf.Broadcast.Driver {
+	case tiered.BroadcastNone:
+	case tiered.BroadcastRedis:
+		transport = bridge.NewRedisTransport(conf.Broadcast.Redis)
+	default:
+		panic("invalid cache broadcast driver: " + conf.Broadcast.Driver)
+	}
+
+	return tiered.NewStorage(conf, l2, transport)
+}
+
+func newEncryptedStorage(stor StorageInterface, conf storage.ConfigEncryption) StorageInterface {
+	if !conf.Enabled {
+		return stor
+	}
+
+	enc, err := NewEncryptedStorage(stor, conf)
+	if err != nil {
+		panic("invalid cache encryption config: " + err.Error())
+	}
+
+	return enc
+}
+
 func getStorageConfig(name string, conf interface{}) (exists bool) {
 	const prefix = "cache."
 	key := prefix + name
@@ -4,13 +4,18 @@ package storage
 import (
 	"time"
 
+	"github.com/olegshs/go-tools/cache/codec"
 	"github.com/olegshs/go-tools/logs"
 )
 
 type Config struct {
-	Driver string    `json:"driver"`
-	TTL    ConfigTTL `json:"ttl"`
-	Log    ConfigLog `json:"log"`
+	Driver string       `json:"driver"`
+	TTL    ConfigTTL    `json:"ttl"`
+	Log    ConfigLog    `json:"log"`
+	Codec  codec.Config `json:"codec"` // кодирование объектов в cache.ObjectStorage
+
+	Encryption ConfigEncryption `json:"encryption"`
+	Metrics    ConfigMetrics    `json:"metrics"`
 }
 
 type ConfigTTL struct {
@@ -24,6 +29,19 @@ type ConfigLog struct {
 	Interval time.Duration `json:"interval"`
 }
 
+// ConfigEncryption задаёт шифрование данных в хранилище, см. cache.EncryptedStorage.
+type ConfigEncryption struct {
+	Enabled bool     `json:"enabled"`
+	Keys    []string `json:"keys"`     // ключи AES в кодировке base64: первый шифрует, остальные только расшифровывают
+	HMACKey string   `json:"hmac_key"` // ключ HMAC-SHA256 для ключей элементов в кодировке base64
+}
+
+// ConfigMetrics задаёт сбор статистики хранилища, см. cache.MetricsStorage.
+// По умолчанию статистика не собирается.
+type ConfigMetrics struct {
+	Enabled bool `json:"enabled"`
+}
+
 func DefaultConfig() Config {
 	return Config{
 		Driver: "",
@@ -36,5 +54,9 @@ func DefaultConfig() Config {
 			Channel:  logs.DefaultChannel,
 			Interval: 60 * time.Second,
 		},
+		Codec: codec.DefaultConfig(),
+		Metrics: ConfigMetrics{
+			Enabled: false,
+		},
 	}
 }
@@ -8,4 +8,9 @@ var (
 	ErrNotFound    = errors.New("not found")
 	ErrExpired     = errors.New("expired")
 	ErrInvalidData = errors.New("invalid data")
+
+	ErrTagsNotSupported = errors.New("tags are not supported by the storage")
+
+	ErrExists          = errors.New("already exists")
+	ErrVersionMismatch = errors.New("version mismatch")
 )
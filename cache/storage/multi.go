@@ -0,0 +1,48 @@
+package storage
+
+// GetMulti читает данные по каждому ключу с помощью функции get.
+// Используется драйверами, которые не поддерживают пакетные операции.
+// Возвращает найденные данные и ошибки по ключам.
+func GetMulti(keys []string, get func(key string) ([]byte, error)) (map[string][]byte, map[string]error) {
+	items := make(map[string][]byte, len(keys))
+	errs := map[string]error{}
+
+	for _, key := range keys {
+		data, err := get(key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		items[key] = data
+	}
+
+	return items, errs
+}
+
+// SetMulti сохраняет каждый элемент с помощью функции set и возвращает ошибки по ключам.
+func SetMulti(items map[string][]byte, set func(key string, data []byte) error) map[string]error {
+	errs := map[string]error{}
+
+	for key, data := range items {
+		err := set(key, data)
+		if err != nil {
+			errs[key] = err
+		}
+	}
+
+	return errs
+}
+
+// DeleteMulti удаляет каждый элемент с помощью функции del и возвращает ошибки по ключам.
+func DeleteMulti(keys []string, del func(key string) error) map[string]error {
+	errs := map[string]error{}
+
+	for _, key := range keys {
+		err := del(key)
+		if err != nil {
+			errs[key] = err
+		}
+	}
+
+	return errs
+}
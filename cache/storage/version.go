@@ -0,0 +1,5 @@
+package storage
+
+// Version — маркер версии элемента, полученный при чтении и передаваемый в CompareAndSwap.
+// Значение зависит от драйвера и не должно использоваться с другим хранилищем.
+type Version interface{}
@@ -2,6 +2,12 @@ package cache
 
 import (
 	"time"
+
+	"github.com/olegshs/go-tools/cache/storage"
+)
+
+var (
+	ErrTagsNotSupported = storage.ErrTagsNotSupported
 )
 
 type StorageInterface interface {
@@ -9,6 +15,35 @@ type StorageInterface interface {
 	Set(key string, data []byte, ttl time.Duration) error
 	Delete(key string) error
 	DeleteAll() error
+
+	// Пакетные операции возвращают ошибки по ключам; отсутствующие
+	// при чтении элементы отмечаются ошибкой storage.ErrNotFound.
+	GetMulti(keys []string) (map[string][]byte, map[string]error)
+	SetMulti(items map[string][]byte, ttl time.Duration) map[string]error
+	DeleteMulti(keys []string) map[string]error
+
+	// Атомарные операции: Add возвращает storage.ErrExists, если элемент уже существует,
+	// CompareAndSwap возвращает storage.ErrVersionMismatch, если элемент изменился
+	// после чтения с помощью GetVersioned.
+	Add(key string, data []byte, ttl time.Duration) error
+	Increment(key string, delta, initial int64, ttl time.Duration) (int64, error)
+	Decrement(key string, delta, initial int64, ttl time.Duration) (int64, error)
+	GetVersioned(key string) ([]byte, storage.Version, error)
+	CompareAndSwap(key string, data []byte, version storage.Version, ttl time.Duration) error
+
 	Hits() int64
 	Misses() int64
 }
+
+// TaggedStorageInterface реализуют хранилища, которые позволяют удалить
+// все элементы с указанным тегом одним вызовом.
+type TaggedStorageInterface interface {
+	StorageInterface
+	SetTagged(key string, data []byte, ttl time.Duration, tags ...string) error
+	InvalidateTags(tags ...string) error
+}
+
+// EvictionsCounter реализуют хранилища, которые вытесняют элементы при ограничении размера.
+type EvictionsCounter interface {
+	Evictions() int64
+}
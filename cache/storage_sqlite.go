@@ -0,0 +1,16 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"github.com/olegshs/go-tools/cache/drivers/sqlite"
+)
+
+func init() {
+	optionalDrivers[DriverSqlite] = func(name string) StorageInterface {
+		conf := sqlite.DefaultConfig()
+		getStorageConfig(name, &conf)
+		conf.Table = conf.Table + "_" + name
+		return sqlite.NewStorage(conf)
+	}
+}
@@ -2,7 +2,9 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -13,6 +15,8 @@ import (
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/olegshs/go-tools/events"
+	"github.com/olegshs/go-tools/helpers"
 	"github.com/olegshs/go-tools/helpers/structmap"
 	"github.com/olegshs/go-tools/helpers/typeconv"
 )
@@ -20,11 +24,65 @@ import (
 var (
 	// BaseDir хранит базовую директорию, которая используется функцией AbsPath.
 	BaseDir = "."
-
-	data  = map[string]interface{}{}
-	mutex = sync.RWMutex{}
 )
 
+// Store хранит конфигурацию: параметры, загруженные из файлов и переменных окружения
+// или установленные функцией Set. Функции пакета работают с хранилищем по умолчанию,
+// см. Default; отдельные хранилища позволяют использовать несколько независимых конфигураций.
+type Store struct {
+	tree      *tree
+	mutex     sync.RWMutex
+	envPrefix string
+	keyring   *Keyring
+	profile   string
+
+	// history хранит последовательность загрузок и изменений конфигурации,
+	// которая воспроизводится при перезагрузке.
+	history []operation
+	// seq — порядковый номер последней добавленной в историю операции
+	seq uint64
+
+	events      *events.Dispatcher
+	reloadMutex sync.Mutex
+
+	watcher       *helpers.Interval
+	watcherStamps map[string]fileStamp
+	watcherMutex  sync.Mutex
+}
+
+// Значения параметров вместе с их происхождением.
+type tree struct {
+	data    map[string]interface{}
+	sources map[string]Source
+
+	// ключи для расшифровки значений и параметры, значения которых были расшифрованы
+	keyring *Keyring
+	secrets map[string]bool
+
+	// профиль конфигурации и все файлы, которые были прочитаны или проверены при загрузке
+	profile string
+	files   []string
+}
+
+func newTree(keyring *Keyring, profile string) *tree {
+	return &tree{
+		profile: profile,
+		data:    map[string]interface{}{},
+		sources: map[string]Source{},
+		keyring: keyring,
+		secrets: map[string]bool{},
+	}
+}
+
+// Операция загрузки файла или установки значения параметра.
+type operation struct {
+	key       string
+	filename  string
+	envPrefix string
+	value     interface{}
+	seq       uint64
+}
+
 func init() {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -51,34 +109,41 @@ func AbsPath(filename string) string {
 	return absPath
 }
 
-// Load загружает в указанный раздел конфигурацию из файла JSON или YAML.
-// Если в директории с файлом есть поддиректория "local",
-// то из неё будет загружен файл с тем же именем, после загрузки указанного файла.
-func Load(key string, filename string) error {
-	m, err := read(filename)
-	if err != nil {
-		return err
-	}
+// NewStore создаёт пустое хранилище конфигурации.
+func NewStore() *Store {
+	s := new(Store)
+	s.tree = newTree(nil, "")
+	s.events = events.New()
 
-	Set(key, m)
+	return s
+}
 
-	localFilename := localFilename(filename)
-	if _, err := os.Stat(localFilename); err == nil {
-		m, err := read(localFilename)
-		if err != nil {
-			return err
-		}
+// Load загружает в указанный раздел конфигурацию из файла.
+// Формат файла определяется по расширению, см. RegisterDecoder.
+// После указанного файла загружаются файлы с тем же именем из поддиректории профиля,
+// см. SetProfile, и из поддиректории "local", если они существуют.
+// Файл может подключать другие файлы, см. IncludeKey.
+// Если задан префикс переменных окружения, то параметры раздела переопределяются ими,
+// см. SetEnvPrefix.
+func (s *Store) Load(key string, filename string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	op := operation{key: key, filename: filename, envPrefix: s.envPrefix}
 
-		Set(key, m)
+	err := op.apply(s.tree)
+	if err != nil {
+		return err
 	}
 
+	s.record(op)
 	return nil
 }
 
-// LoadAll загружает конфигурации из всех файлов JSON или YAML,
-// которые соответствуют указанной маске.
+// LoadAll загружает конфигурации из всех файлов,
+// которые соответствуют указанной маске. Файлы могут быть в разных форматах.
 // Имена файлов считаются именами разделов.
-func LoadAll(pattern string) error {
+func (s *Store) LoadAll(pattern string) error {
 	dirname := path.Dir(pattern)
 	pattern = path.Base(pattern)
 
@@ -105,7 +170,7 @@ func LoadAll(pattern string) error {
 		ext := path.Ext(filename)
 		name := filename[:len(filename)-len(ext)]
 
-		err = Load(name, dirname+"/"+filename)
+		err = s.Load(name, dirname+"/"+filename)
 		if err != nil {
 			return err
 		}
@@ -115,52 +180,25 @@ func LoadAll(pattern string) error {
 }
 
 // Set устанавливает значение параметра.
-func Set(key string, value interface{}) {
-	mutex.Lock()
-	defer mutex.Unlock()
+func (s *Store) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	set(key, value)
-}
+	op := operation{key: key, value: value}
+	op.apply(s.tree)
 
-func set(key string, value interface{}) {
-	a := strings.Split(key, ".")
-	n := len(a)
-	if n > 1 {
-		parentKey := strings.Join(a[:n-1], ".")
-		_, parentExists := data[parentKey]
-		if !parentExists {
-			set(parentKey, map[string]interface{}{
-				a[n-1]: value,
-			})
-			return
-		}
-	}
-
-	data[key] = merge(data[key], value)
-
-	m, ok := value.(map[string]interface{})
-	if ok {
-		for k, v := range m {
-			set(key+"."+k, v)
-		}
-	}
+	s.record(op)
 }
 
 // Exists проверяет существование параметра.
-func Exists(key string) bool {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
-	_, ok := data[key]
+func (s *Store) Exists(key string) bool {
+	_, ok := s.lookup(key)
 	return ok
 }
 
 // Get возвращает значение параметра.
-func Get(key string, defaultValue interface{}) interface{} {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
-	value, ok := data[key]
+func (s *Store) Get(key string, defaultValue interface{}) interface{} {
+	value, ok := s.lookup(key)
 	if !ok {
 		return defaultValue
 	}
@@ -169,26 +207,26 @@ func Get(key string, defaultValue interface{}) interface{} {
 }
 
 // GetBool возвращает значение параметра с преобразованием в булев тип.
-func GetBool(key string, defaultValue bool) bool {
-	value := Get(key, defaultValue)
+func (s *Store) GetBool(key string, defaultValue bool) bool {
+	value := s.Get(key, defaultValue)
 	return typeconv.Bool(value)
 }
 
 // GetInt возвращает значение параметра с преобразованием в целое число.
-func GetInt(key string, defaultValue int) int {
-	value := Get(key, defaultValue)
+func (s *Store) GetInt(key string, defaultValue int) int {
+	value := s.Get(key, defaultValue)
 	return typeconv.Int(value)
 }
 
 // GetString возвращает значение параметра с преобразованием в строку.
-func GetString(key string, defaultValue string) string {
-	value := Get(key, defaultValue)
+func (s *Store) GetString(key string, defaultValue string) string {
+	value := s.Get(key, defaultValue)
 	return typeconv.String(value)
 }
 
 // GetStruct копирует значения раздела в структуру.
-func GetStruct(key string, dst interface{}) {
-	m, ok := Get(key, nil).(map[string]interface{})
+func (s *Store) GetStruct(key string, dst interface{}) {
+	m, ok := s.Get(key, nil).(map[string]interface{})
 	if !ok {
 		return
 	}
@@ -197,8 +235,8 @@ func GetStruct(key string, dst interface{}) {
 }
 
 // GetSlice копирует значения раздела в массив.
-func GetSlice(key string, dst interface{}) {
-	a, ok := Get(key, nil).([]interface{})
+func (s *Store) GetSlice(key string, dst interface{}) {
+	a, ok := s.Get(key, nil).([]interface{})
 	if !ok {
 		return
 	}
@@ -206,6 +244,225 @@ func GetSlice(key string, dst interface{}) {
 	structmap.ToSlice(a, dst)
 }
 
+func (s *Store) lookup(key string) (interface{}, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value, ok := s.tree.data[key]
+	return value, ok
+}
+
+// record добавляет операцию в историю и удаляет из неё операции, которые новая операция
+// полностью заменяет, чтобы история не росла при повторных вызовах Set и LoadEnv:
+//   - LoadEnv с тем же префиксом;
+//   - Set того же параметра, если новое значение не является разделом;
+//   - Set того же раздела, если после неё не было других операций с этим разделом;
+//     прежнее значение объединяется с новым.
+//
+// Вызывается под блокировкой хранилища.
+func (s *Store) record(op operation) {
+	switch {
+	case op.filename != "":
+
+	case op.envPrefix != "":
+		s.history = removeOperations(s.history, func(i int, prev operation) bool {
+			return prev.filename == "" && prev.envPrefix == op.envPrefix
+		})
+
+	default:
+		_, isMap := op.value.(map[string]interface{})
+		last := len(s.history)
+
+		s.history = removeOperations(s.history, func(i int, prev operation) bool {
+			if !prev.isSet() || prev.key != op.key {
+				return false
+			}
+			if !isMap {
+				return true
+			}
+
+			prevMap, ok := prev.value.(map[string]interface{})
+			if !ok || s.touched(op.key, i+1, last) {
+				return false
+			}
+
+			op.value = merge(prevMap, op.value)
+			return true
+		})
+	}
+
+	s.seq++
+	op.seq = s.seq
+
+	s.history = append(s.history, op)
+}
+
+// touched сообщает, изменяют ли операции истории с номерами от from до to
+// параметр key, вложенные в него или содержащие его разделы.
+func (s *Store) touched(key string, from, to int) bool {
+	for _, op := range s.history[from:to] {
+		if op.filename == "" && op.envPrefix != "" {
+			return true
+		}
+		if op.key == "" || op.key == key ||
+			strings.HasPrefix(op.key, key+".") || strings.HasPrefix(key, op.key+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeOperations удаляет из истории операции, для которых f возвращает true.
+// Функции f передаются номер операции в исходной истории и сама операция.
+func removeOperations(history []operation, f func(i int, op operation) bool) []operation {
+	a := history[:0]
+	for i, op := range history {
+		if !f(i, op) {
+			a = append(a, op)
+		}
+	}
+
+	// освобождение ссылок на значения удалённых операций
+	for i := len(a); i < len(history); i++ {
+		history[i] = operation{}
+	}
+
+	return a
+}
+
+func (op operation) isSet() bool {
+	return op.filename == "" && op.envPrefix == ""
+}
+
+func (op operation) apply(t *tree) error {
+	switch {
+	case op.filename != "":
+		err := t.load(op.key, op.filename)
+		if err != nil {
+			return err
+		}
+
+		if op.envPrefix != "" {
+			t.loadEnv(op.envPrefix, op.key)
+		}
+
+	case op.envPrefix != "":
+		t.loadEnv(op.envPrefix, "")
+
+	default:
+		t.set(op.key, op.value, Source{Layer: LayerSet})
+	}
+
+	return nil
+}
+
+// load загружает файл и файлы, которые его переопределяют: файл профиля и файл из директории "local".
+func (t *tree) load(key string, filename string) error {
+	err := t.loadFile(key, filename, LayerFile, nil)
+	if err != nil {
+		return err
+	}
+
+	var overrides []string
+	if profile := t.currentProfile(); profile != "" {
+		overrides = append(overrides, LayerProfile, profileFilename(filename, profile))
+	}
+	overrides = append(overrides, LayerLocal, localFilename(filename))
+
+	for i := 0; i < len(overrides); i += 2 {
+		layer, filename := overrides[i], overrides[i+1]
+
+		// отсутствующие файлы отслеживаются, чтобы обнаружить их появление
+		t.files = append(t.files, AbsPath(filename))
+		if _, err := os.Stat(AbsPath(filename)); err != nil {
+			continue
+		}
+
+		err = t.loadFile(key, filename, layer, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadFile загружает файл вместе с подключаемыми в нём файлами, см. IncludeKey.
+// parents содержит цепочку подключений для обнаружения циклов.
+func (t *tree) loadFile(key string, filename string, layer string, parents []string) error {
+	absPath := AbsPath(filename)
+	for _, parent := range parents {
+		if parent == absPath {
+			return fmt.Errorf("%s: include cycle", filename)
+		}
+	}
+
+	t.files = append(t.files, absPath)
+
+	m, lines, err := read(filename)
+	if err != nil {
+		return err
+	}
+
+	files, err := includes(absPath, m)
+	if err != nil {
+		return err
+	}
+
+	for _, include := range files {
+		err = t.loadFile(key, include, layer, append(parents, absPath))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = t.decryptSecrets(key, m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	t.setFile(key, m, Source{Layer: layer, File: filename}, lines)
+	return nil
+}
+
+// set устанавливает значение параметра и запоминает его происхождение.
+func (t *tree) set(key string, value interface{}, src Source) {
+	set(t.data, key, value)
+	trace(t.sources, key, value, src, nil, "")
+}
+
+// setFile устанавливает значения параметров из файла, lines содержит номера строк
+// для ключей относительно корня файла.
+func (t *tree) setFile(key string, m map[string]interface{}, src Source, lines map[string]int) {
+	set(t.data, key, m)
+	trace(t.sources, key, m, src, lines, "")
+}
+
+func set(data map[string]interface{}, key string, value interface{}) {
+	a := strings.Split(key, ".")
+	n := len(a)
+	if n > 1 {
+		parentKey := strings.Join(a[:n-1], ".")
+		_, parentExists := data[parentKey]
+		if !parentExists {
+			set(data, parentKey, map[string]interface{}{
+				a[n-1]: value,
+			})
+			return
+		}
+	}
+
+	data[key] = merge(data[key], value)
+
+	m, ok := value.(map[string]interface{})
+	if ok {
+		for k, v := range m {
+			set(data, key+"."+k, v)
+		}
+	}
+}
+
 func localFilename(filename string) string {
 	dir := path.Dir(filename)
 	base := path.Base(filename)
@@ -213,30 +470,22 @@ func localFilename(filename string) string {
 	return local
 }
 
-func read(filename string) (map[string]interface{}, error) {
+func read(filename string) (map[string]interface{}, map[string]int, error) {
 	filename = AbsPath(filename)
 	ext := path.Ext(filename)
 
-	f, err := os.Open(filename)
+	b, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var m map[string]interface{}
-
-	switch ext {
-	case ".json":
-		m, err = decodeJson(f)
-	default:
-		m, err = decodeYaml(f)
+		return nil, nil, err
 	}
 
+	m, err := decoder(ext)(bytes.NewReader(preprocessSecrets(ext, b)))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return m, nil
+	m = interpolate(m).(map[string]interface{})
+	return m, locateLines(ext, b), nil
 }
 
 func decodeJson(f io.Reader) (map[string]interface{}, error) {
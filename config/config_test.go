@@ -0,0 +1,802 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filename, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestLoad_Env(t *testing.T) {
+	s := NewStore()
+
+	dir := t.TempDir()
+	filename := writeTestFile(t, dir, "envtest.yaml", `
+default:
+  host: ${TEST_CONFIG_HOST:-localhost}
+  port: 5432
+  debug: true
+  dsn: "${TEST_CONFIG_USER}@${TEST_CONFIG_HOST:-localhost}"
+`)
+
+	t.Setenv("TEST_CONFIG_USER", "admin")
+	t.Setenv("TESTAPP_ENVTEST__DEFAULT__PORT", "6543")
+	t.Setenv("TESTAPP_ENVTEST__DEFAULT__DEBUG", "false")
+	t.Setenv("TESTAPP_ENVTEST__DEFAULT__MAX_IDLE", "10")
+
+	s.SetEnvPrefix("TESTAPP")
+
+	err := s.Load("envtest", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.GetString("envtest.default.host", ""); v != "localhost" {
+		t.Errorf(`envtest.default.host: "%s" != "localhost"`, v)
+	}
+
+	if v := s.GetString("envtest.default.dsn", ""); v != "admin@localhost" {
+		t.Errorf(`envtest.default.dsn: "%s" != "admin@localhost"`, v)
+	}
+
+	if v, ok := s.Get("envtest.default.port", nil).(int); !ok || v != 6543 {
+		t.Errorf(`envtest.default.port: %#v != 6543`, s.Get("envtest.default.port", nil))
+	}
+
+	if s.GetBool("envtest.default.debug", true) {
+		t.Error(`envtest.default.debug != false`)
+	}
+
+	if i := s.GetInt("envtest.default.max_idle", 0); i != 10 {
+		t.Errorf(`envtest.default.max_idle: %d != 10`, i)
+	}
+
+	var conf struct {
+		Port  int  `json:"port"`
+		Debug bool `json:"debug"`
+	}
+	s.GetStruct("envtest.default", &conf)
+
+	if conf.Port != 6543 || conf.Debug {
+		t.Errorf(`envtest.default: %+v != {Port:6543 Debug:false}`, conf)
+	}
+
+	jsonFile := writeTestFile(t, dir, "envjson.json", `{"port": 5432, "timeout": 30, "retries": 3}`)
+
+	t.Setenv("TESTAPP_ENVJSON__PORT", "abc")
+	t.Setenv("TESTAPP_ENVJSON__TIMEOUT", "15")
+	t.Setenv("TESTAPP_ENVJSON__RETRIES", "0x10")
+
+	err = s.Load("envjson", jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := s.Get("envjson.port", nil).(string); !ok || v != "abc" {
+		t.Errorf(`envjson.port: %#v != "abc"`, s.Get("envjson.port", nil))
+	}
+	if v, ok := s.Get("envjson.retries", nil).(string); !ok || v != "0x10" {
+		t.Errorf(`envjson.retries: %#v != "0x10"`, s.Get("envjson.retries", nil))
+	}
+	if i := s.GetInt("envjson.timeout", 0); i != 15 {
+		t.Errorf(`envjson.timeout: %d != 15`, i)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("TEST_CONFIG_EMPTY", "")
+	t.Setenv("TEST_CONFIG_NAME", "abc")
+
+	tests := map[string]string{
+		"${TEST_CONFIG_NAME}":            "abc",
+		"${TEST_CONFIG_NAME:-x}":         "abc",
+		"${TEST_CONFIG_EMPTY:-x}":        "x",
+		"${TEST_CONFIG_UNDEFINED:-x}":    "x",
+		"${TEST_CONFIG_UNDEFINED}":       "",
+		"a/${TEST_CONFIG_NAME}/b":        "a/abc/b",
+		"$TEST_CONFIG_NAME":              "$TEST_CONFIG_NAME",
+		"${TEST_CONFIG_UNDEFINED:-a b}!": "a b!",
+	}
+
+	for s, expected := range tests {
+		if v := expandEnv(s); v != expected {
+			t.Errorf(`expandEnv("%s"): "%s" != "%s"`, s, v, expected)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := NewStore()
+
+	dir := t.TempDir()
+	filename := writeTestFile(t, dir, "reloadtest.yaml", `
+server:
+  port: 80
+log:
+  level: info
+`)
+
+	err := s.Load("reloadtest", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("reloadtest.extra", "x")
+
+	changed := map[string]int{}
+	s.OnChange("reloadtest.server", func(key string) {
+		changed[key]++
+	})
+	s.OnChange("reloadtest.log", func(key string) {
+		changed[key]++
+	})
+
+	writeTestFile(t, dir, "local/reloadtest.yaml", `
+server:
+  port: 8080
+`)
+
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := s.GetInt("reloadtest.server.port", 0); i != 8080 {
+		t.Errorf(`reloadtest.server.port: %d != 8080`, i)
+	}
+
+	if v := s.GetString("reloadtest.extra", ""); v != "x" {
+		t.Errorf(`reloadtest.extra: "%s" != "x"`, v)
+	}
+
+	if changed["reloadtest.server"] != 1 {
+		t.Error(`reloadtest.server: change is not dispatched`)
+	}
+
+	if changed["reloadtest.log"] != 0 {
+		t.Error(`reloadtest.log: change is dispatched, but the section is not changed`)
+	}
+}
+
+func TestReload_History(t *testing.T) {
+	s := NewStore()
+
+	for i := 0; i < 100; i++ {
+		s.Set("historytest.counter", i)
+		s.Set("historytest.section", map[string]interface{}{
+			"a": i,
+		})
+		s.Set("historytest.section", map[string]interface{}{
+			"b": i,
+		})
+	}
+	for i := 0; i < 100; i++ {
+		s.LoadEnv("HISTORYTEST")
+	}
+
+	if n := len(s.history); n != 3 {
+		t.Errorf(`history length: %d != 3`, n)
+	}
+
+	err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := s.GetInt("historytest.counter", 0); i != 99 {
+		t.Errorf(`historytest.counter: %d != 99`, i)
+	}
+	if i := s.GetInt("historytest.section.a", 0); i != 99 {
+		t.Errorf(`historytest.section.a: %d != 99`, i)
+	}
+	if i := s.GetInt("historytest.section.b", 0); i != 99 {
+		t.Errorf(`historytest.section.b: %d != 99`, i)
+	}
+}
+
+func TestGetStructValid(t *testing.T) {
+	s := NewStore()
+
+	s.Set("validtest", map[string]interface{}{
+		"server": map[string]interface{}{
+			"host":    "localhost",
+			"port":    70000,
+			"timeout": "5x",
+			"mode":    "fast",
+			"prot":    "http",
+		},
+		"workers": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": ""},
+		},
+	})
+
+	type Server struct {
+		Host    string        `json:"host" validate:"required"`
+		Port    int           `json:"port" validate:"required,min=1,max=65535"`
+		Timeout time.Duration `json:"timeout"`
+		Mode    string        `json:"mode" validate:"enum=sync|async"`
+		Proto   string        `json:"proto" validate:"required"`
+	}
+
+	type Worker struct {
+		Name string `json:"name" validate:"min=1"`
+	}
+
+	var conf struct {
+		Server  Server   `json:"server"`
+		Workers []Worker `json:"workers"`
+	}
+
+	err := s.GetStructValid("validtest", &conf)
+
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf(`%v is not *ValidationError`, err)
+	}
+
+	expected := map[string]bool{
+		"validtest.server.port":       true,
+		"validtest.server.timeout":    true,
+		"validtest.server.mode":       true,
+		"validtest.server.proto":      true,
+		"validtest.workers[1].name":   true,
+		"validtest.server.prot":       false,
+		"validtest.server.host":       false,
+		"validtest.workers[0].name":   false,
+		"validtest.server.max_idle":   false,
+		"validtest.server.unexpected": false,
+	}
+
+	keys := map[string]bool{}
+	for _, e := range validationErr.Errors {
+		keys[e.Key] = true
+	}
+
+	for key, isExpected := range expected {
+		if keys[key] != isExpected {
+			t.Errorf(`%s: error expected: %v, got: %v`, key, isExpected, keys[key])
+		}
+	}
+
+	err = s.GetStructStrict("validtest", &conf)
+
+	validationErr, ok = err.(*ValidationError)
+	if !ok {
+		t.Fatalf(`%v is not *ValidationError`, err)
+	}
+
+	found := false
+	for _, e := range validationErr.Errors {
+		if e.Key == "validtest.server.prot" && e.Message == "unknown key" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error(`validtest.server.prot: unknown key is not reported`)
+	}
+
+	if conf.Server.Host != "" {
+		t.Error(`struct is filled despite validation errors`)
+	}
+}
+
+func TestLoadAll_Formats(t *testing.T) {
+	s := NewStore()
+
+	dir := t.TempDir()
+
+	writeTestFile(t, dir, "app.toml", `
+# comment
+title = "TOML \"example\""
+ports = [ 8000, 8001,
+  8002, ]  # trailing comma
+
+[database.default]
+host = 'localhost'
+port = 5_432
+enabled = true
+ratio = 0.5
+created = 1979-05-27 07:32:00Z
+inline = { a = 1, b.c = "x" }
+
+[[servers]]
+name = "alpha"
+
+[[servers]]
+name = "beta"
+text = """
+line 1 \
+  continued"""
+`)
+
+	writeTestFile(t, dir, "legacy.ini", `
+; comment
+name = legacy app
+[database.default]
+host = "db.local"
+port = 3306 ; inline comment
+debug = false
+[modules]
+list[] = a
+list[] = b
+`)
+
+	writeTestFile(t, dir, "secrets.env", `
+# comment
+export API_KEY="abc\n\"def\""
+DATABASE__DEFAULT__PASSWORD='p@ss#1'
+DATABASE__DEFAULT__PORT=0123
+TIMEOUT=30 # seconds
+`)
+
+	err := s.LoadAll(filepath.Join(dir, "*.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		"app.title":                         `TOML "example"`,
+		"app.database.default.host":         "localhost",
+		"app.database.default.port":         5432,
+		"app.database.default.enabled":      true,
+		"app.database.default.ratio":        0.5,
+		"app.database.default.created":      "1979-05-27 07:32:00Z",
+		"app.database.default.inline.a":     1,
+		"legacy.name":                       "legacy app",
+		"legacy.database.default.host":      "db.local",
+		"legacy.database.default.port":      3306,
+		"legacy.database.default.debug":     false,
+		"secrets.api_key":                   "abc\n\"def\"",
+		"secrets.database.default.password": "p@ss#1",
+		"secrets.database.default.port":     "0123",
+		"secrets.timeout":                   30,
+	}
+
+	for key, expected := range tests {
+		if v := s.Get(key, nil); v != expected {
+			t.Errorf(`%s: %#v != %#v`, key, v, expected)
+		}
+	}
+
+	var servers []struct {
+		Name string `json:"name"`
+		Text string `json:"text"`
+	}
+	s.GetSlice("app.servers", &servers)
+
+	if len(servers) != 2 || servers[1].Name != "beta" || servers[1].Text != "line 1 continued" {
+		t.Errorf(`app.servers: %+v`, servers)
+	}
+
+	if a, _ := s.Get("app.ports", nil).([]interface{}); len(a) != 3 {
+		t.Errorf(`app.ports: %v`, a)
+	}
+
+	if a, _ := s.Get("legacy.modules.list", nil).([]interface{}); len(a) != 2 || a[1] != "b" {
+		t.Errorf(`legacy.modules.list: %v`, a)
+	}
+}
+
+func TestDecodeToml_Errors(t *testing.T) {
+	tests := []string{
+		"a = 1\na = 2",
+		"[a]\n[a]",
+		"a = \"unterminated",
+		"a = [1, 2",
+		"a = 1 b = 2",
+		"a = x",
+		"a = _",
+	}
+
+	for _, s := range tests {
+		_, err := decodeToml(strings.NewReader(s))
+		if err == nil {
+			t.Errorf(`decodeToml(%q): error expected`, s)
+		}
+	}
+
+	_, err := decodeToml(strings.NewReader("a = 1\n\n# comment\nb = \"\"\"\n\n\"\"\"\nc = x"))
+	if err == nil || !strings.Contains(err.Error(), "line 7:") {
+		t.Errorf(`decodeToml(): %v, expected error on line 7`, err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	s := NewStore()
+
+	s.Set("valuetest", map[string]interface{}{
+		"timeout": "1m30s",
+		"ttl":     5,
+		"hosts":   []interface{}{"a", "b"},
+		"ports":   []interface{}{"80", 443},
+		"weights": map[string]interface{}{"a": 1, "b": "2"},
+		"level":   "debug",
+		"enabled": true,
+		"server": map[string]interface{}{
+			"port": 8080,
+		},
+	})
+
+	if d := Value(s, "valuetest.timeout", time.Duration(0)); d != 90*time.Second {
+		t.Errorf(`valuetest.timeout: %v != 1m30s`, d)
+	}
+
+	if d := Value(s, "valuetest.ttl", time.Duration(0)); d != 5*time.Second {
+		t.Errorf(`valuetest.ttl: %v != 5s`, d)
+	}
+
+	if d := Value(s, "valuetest.undefined", time.Minute); d != time.Minute {
+		t.Errorf(`valuetest.undefined: %v != 1m`, d)
+	}
+
+	if a := Value[[]string](s, "valuetest.hosts", nil); len(a) != 2 || a[1] != "b" {
+		t.Errorf(`valuetest.hosts: %v != [a b]`, a)
+	}
+
+	if a := Value[[]int](s, "valuetest.ports", nil); len(a) != 2 || a[0] != 80 || a[1] != 443 {
+		t.Errorf(`valuetest.ports: %v != [80 443]`, a)
+	}
+
+	if m := Value[map[string]int](s, "valuetest.weights", nil); len(m) != 2 || m["b"] != 2 {
+		t.Errorf(`valuetest.weights: %v != map[a:1 b:2]`, m)
+	}
+
+	if i := Value(s, "valuetest.level", 7); i != 0 {
+		t.Errorf(`valuetest.level: %d != 0`, i)
+	}
+
+	if a := Value(s, "valuetest.level", []string{"default"}); len(a) != 1 || a[0] != "default" {
+		t.Errorf(`valuetest.level: %v != [default]`, a)
+	}
+
+	type Level string
+	if v := Value[Level](s, "valuetest.level", "info"); v != "debug" {
+		t.Errorf(`valuetest.level: %v != debug`, v)
+	}
+
+	if v := Value(s, "valuetest.enabled", false); !v {
+		t.Error(`valuetest.enabled != true`)
+	}
+
+	type Server struct {
+		Port int `json:"port"`
+	}
+	if v := Value(s, "valuetest.server", Server{}); v.Port != 8080 {
+		t.Errorf(`valuetest.server: %+v != {Port:8080}`, v)
+	}
+
+	if v := Value[[]int](s, "valuetest.server", []int{1}); len(v) != 1 {
+		t.Errorf(`valuetest.server: %v != default`, v)
+	}
+
+	if Exists("valuetest") {
+		t.Error(`valuetest: store is not isolated from the default store`)
+	}
+}
+
+func TestDump(t *testing.T) {
+	s := NewStore()
+
+	dir := t.TempDir()
+	yamlFile := writeTestFile(t, dir, "app.yaml", `
+# comment
+database:
+  host: localhost
+  password: qwerty
+  replicas:
+    - host: replica1
+      password: secret1
+`)
+	tomlFile := writeTestFile(t, dir, "cache.toml", `
+[redis]
+addr = "localhost:6379"
+`)
+
+	t.Setenv("DUMPTEST_APP__DATABASE__PORT", "5432")
+
+	s.SetEnvPrefix("DUMPTEST")
+
+	err := s.Load("app", yamlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Load("cache", tomlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("app.name", "test")
+
+	if src, ok := s.Source("app.database.host"); !ok || src.Layer != LayerFile || src.File != yamlFile || src.Line != 4 {
+		t.Errorf(`app.database.host: %+v`, src)
+	}
+
+	if src, _ := s.Source("cache.redis.addr"); src.Line != 3 {
+		t.Errorf(`cache.redis.addr: line %d != 3`, src.Line)
+	}
+
+	if src, _ := s.Source("app.database.port"); src.Layer != LayerEnv || src.Env != "DUMPTEST_APP__DATABASE__PORT" {
+		t.Errorf(`app.database.port: %+v`, src)
+	}
+
+	if src, _ := s.Source("app.name"); src.Layer != LayerSet {
+		t.Errorf(`app.name: %+v`, src)
+	}
+
+	if _, ok := s.Source("app.database"); ok {
+		t.Error(`app.database: sections must not have a source`)
+	}
+
+	buf := bytes.Buffer{}
+
+	err = s.Dump(&buf, FormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "    host: localhost  # file "+yamlFile+":4\n") {
+		t.Errorf(`yaml dump: no source for app.database.host:\n%s`, out)
+	}
+	if !strings.Contains(out, "password: qwerty") {
+		t.Errorf(`yaml dump: password is masked:\n%s`, out)
+	}
+
+	buf.Reset()
+
+	err = s.DumpMasked(&buf, FormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = buf.String()
+	if strings.Contains(out, "qwerty") || strings.Contains(out, "secret1") {
+		t.Errorf(`yaml dump: password is not masked:\n%s`, out)
+	}
+
+	buf.Reset()
+
+	err = s.DumpMasked(&buf, FormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]map[string]map[string]map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := m["app"]["database"]["port"]; v["value"] != "5432" || v["source"] != "env DUMPTEST_APP__DATABASE__PORT" {
+		t.Errorf(`json dump: app.database.port: %v`, v)
+	}
+	if v := m["app"]["database"]["password"]; v["value"] != "******" {
+		t.Errorf(`json dump: app.database.password: %v`, v)
+	}
+
+	err = s.Dump(&buf, "xml")
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf(`unknown format: %v`, err)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+
+	keyring, err := ParseKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := keyring.Encrypt("tagged")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	yamlFile := writeTestFile(t, dir, "db.yaml", `
+default:
+  host: localhost
+  password: "qwerty"  # comment
+  token: !secret `+strings.TrimPrefix(encrypted, SecretPrefix)+`
+  user: admin
+  hint: "use !secret QUJD for encrypted values"
+  # token: enc:QUJD
+`)
+	tomlFile := writeTestFile(t, dir, "auth.toml", `
+[cookie]
+secret = 'cookie-secret'
+`)
+
+	err = EncryptFile(yamlFile, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EncryptFile(tomlFile, keyring, "cookie.secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(yamlFile)
+	if strings.Contains(string(b), "qwerty") || !strings.Contains(string(b), "# comment") {
+		t.Errorf(`EncryptFile:\n%s`, b)
+	}
+
+	rotated, err := ParseKeyring(newKey + "," + oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RotateFile(yamlFile, rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore()
+
+	err = s.Load("db", yamlFile)
+	if !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf(`no key: %v`, err)
+	}
+
+	t.Setenv(SecretKeyEnv, newKey)
+
+	err = s.Load("db", yamlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Load("auth", tomlFile)
+	if !errors.Is(err, ErrDecryptSecret) || strings.Contains(err.Error(), "cookie-secret") {
+		t.Errorf(`old key: %v`, err)
+	}
+
+	s.SetKeyring(rotated)
+
+	err = s.Load("auth", tomlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.GetString("db.default.password", ""); v != "qwerty" {
+		t.Errorf(`db.default.password: "%s" != "qwerty"`, v)
+	}
+	if v := s.GetString("db.default.token", ""); v != "tagged" {
+		t.Errorf(`db.default.token: "%s" != "tagged"`, v)
+	}
+	if v := s.GetString("db.default.hint", ""); v != "use !secret QUJD for encrypted values" {
+		t.Errorf(`db.default.hint: "%s"`, v)
+	}
+	if b, _ := os.ReadFile(yamlFile); !strings.Contains(string(b), "# token: enc:QUJD\n") {
+		t.Errorf(`RotateFile changed a commented-out value:\n%s`, b)
+	}
+	if v := s.GetString("auth.cookie.secret", ""); v != "cookie-secret" {
+		t.Errorf(`auth.cookie.secret: "%s" != "cookie-secret"`, v)
+	}
+	if !s.IsSecret("db.default.password") || s.IsSecret("db.default.user") {
+		t.Error(`IsSecret`)
+	}
+
+	buf := bytes.Buffer{}
+
+	err = s.Dump(&buf, FormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "qwerty") || strings.Contains(out, "tagged") || strings.Contains(out, "cookie-secret") {
+		t.Errorf(`dump contains decrypted values:\n%s`, out)
+	}
+	if !strings.Contains(out, "user: admin") {
+		t.Errorf(`dump:\n%s`, out)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	filename := writeTestFile(t, dir, "conf/app.yaml", `
+include: common/base.yaml
+name: base
+db:
+  host: base
+  port: 5432
+`)
+	writeTestFile(t, dir, "conf/common/base.yaml", `
+include: [ shared.yaml ]
+name: common
+debug: false
+`)
+	writeTestFile(t, dir, "conf/common/shared.yaml", `
+shared: true
+`)
+	writeTestFile(t, dir, "conf/production/app.yaml", `
+db:
+  host: production
+`)
+	writeTestFile(t, dir, "conf/test/app.yaml", `
+db:
+  host: test
+`)
+	writeTestFile(t, dir, "conf/local/app.yaml", `
+db:
+  port: 6543
+`)
+
+	t.Setenv(ProfileEnv, "production")
+	t.Setenv("PROFILETEST_APP__DEBUG", "true")
+
+	s := NewStore()
+	s.SetEnvPrefix("PROFILETEST")
+
+	err := s.Load("app", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.GetString("app.name", ""); v != "base" {
+		t.Errorf(`app.name: "%s" != "base"`, v)
+	}
+	if !s.GetBool("app.shared", false) || !s.GetBool("app.debug", false) {
+		t.Error(`app.shared, app.debug != true`)
+	}
+	if s.Exists("app.include") {
+		t.Error(`app.include exists`)
+	}
+	if v := s.GetString("app.db.host", ""); v != "production" {
+		t.Errorf(`app.db.host: "%s" != "production"`, v)
+	}
+	if v := s.GetInt("app.db.port", 0); v != 6543 {
+		t.Errorf(`app.db.port: %d != 6543`, v)
+	}
+	if src, _ := s.Source("app.db.host"); src.Layer != LayerProfile {
+		t.Errorf(`app.db.host: %+v`, src)
+	}
+	if src, _ := s.Source("app.shared"); src.Layer != LayerFile || !strings.HasSuffix(src.File, "shared.yaml") {
+		t.Errorf(`app.shared: %+v`, src)
+	}
+
+	s.SetProfile("test")
+
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.GetString("app.db.host", ""); v != "test" {
+		t.Errorf(`app.db.host: "%s" != "test"`, v)
+	}
+
+	writeTestFile(t, dir, "conf/common/shared.yaml", `
+include: ../app.yaml
+`)
+
+	err = s.Reload()
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf(`include cycle: %v`, err)
+	}
+}
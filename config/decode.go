@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Decoder преобразует содержимое файла конфигурации в карту параметров.
+type Decoder func(r io.Reader) (map[string]interface{}, error)
+
+var (
+	decoders = map[string]Decoder{
+		".json": decodeJson,
+		".yaml": decodeYaml,
+		".yml":  decodeYaml,
+		".toml": decodeToml,
+		".ini":  decodeIni,
+		".env":  decodeDotenv,
+	}
+	decodersMutex = sync.RWMutex{}
+
+	// Функции, находящие номера строк ключей для встроенных форматов.
+	lineLocators = map[string]func([]byte) map[string]int{
+		".json": yamlLines,
+		".yaml": yamlLines,
+		".yml":  yamlLines,
+		".toml": tomlLines,
+		".ini":  iniLines,
+		".env":  dotenvLines,
+	}
+
+	scalarIntRegexp   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	scalarFloatRegexp = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)\.[0-9]+([eE][-+]?[0-9]+)?$`)
+)
+
+// RegisterDecoder назначает функцию для чтения файлов с указанным расширением,
+// например ".toml". Файлы с незарегистрированными расширениями читаются как YAML.
+func RegisterDecoder(ext string, d Decoder) {
+	decodersMutex.Lock()
+	defer decodersMutex.Unlock()
+
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	ext = strings.ToLower(ext)
+	decoders[ext] = d
+	delete(lineLocators, ext)
+}
+
+func decoder(ext string) Decoder {
+	decodersMutex.RLock()
+	defer decodersMutex.RUnlock()
+
+	d, ok := decoders[strings.ToLower(ext)]
+	if !ok {
+		return decodeYaml
+	}
+
+	return d
+}
+
+// parseScalar преобразует строковое значение из файлов INI и .env в число или булев тип,
+// если строка содержит их каноническую запись. Остальные значения остаются строками.
+func parseScalar(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if scalarIntRegexp.MatchString(s) {
+		i, err := strconv.ParseInt(s, 10, 0)
+		if err == nil {
+			return int(i)
+		}
+	}
+
+	if scalarFloatRegexp.MatchString(s) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil {
+			return f
+		}
+	}
+
+	return s
+}
+
+// subMap возвращает вложенный раздел карты, создавая его и промежуточные разделы при необходимости.
+// Если на пути встречается значение, не являющееся разделом, то возвращает false.
+func subMap(m map[string]interface{}, keys []string) (map[string]interface{}, bool) {
+	for _, k := range keys {
+		switch t := m[k].(type) {
+		case map[string]interface{}:
+			m = t
+		case nil:
+			sub := map[string]interface{}{}
+			m[k] = sub
+			m = sub
+		default:
+			return nil, false
+		}
+	}
+
+	return m, true
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/olegshs/go-tools/helpers"
+)
+
+// decodeDotenv читает файл .env.
+//
+// Названия переменных преобразуются в названия параметров так же, как в LoadEnv:
+// переменная DATABASE__DEFAULT__HOST задаёт параметр database.default.host.
+// Значения в двойных кавычках могут занимать несколько строк и содержать
+// экранированные символы \n, \t, \" и \\. Значения в одинарных кавычках не обрабатываются.
+func decodeDotenv(r io.Reader) (map[string]interface{}, error) {
+	m, _, err := parseDotenv(r)
+	return m, err
+}
+
+func dotenvLines(b []byte) map[string]int {
+	_, lines, _ := parseDotenv(bytes.NewReader(b))
+	return lines
+}
+
+func parseDotenv(r io.Reader) (map[string]interface{}, map[string]int, error) {
+	m := map[string]interface{}{}
+	lines := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		s := helpers.Trim(scanner.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+
+		s = strings.TrimPrefix(s, "export ")
+
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("dotenv: line %d: expected NAME=value", line)
+		}
+
+		name := helpers.Trim(s[:i])
+		start := line
+		raw := helpers.TrimLeft(s[i+1:])
+
+		var value interface{}
+
+		switch {
+		case strings.HasPrefix(raw, `"`):
+			for !hasClosingQuote(raw[1:]) {
+				if !scanner.Scan() {
+					return nil, nil, fmt.Errorf("dotenv: line %d: unterminated quoted value", start)
+				}
+				line++
+				raw += "\n" + scanner.Text()
+			}
+			value = unquoteDotenv(raw[1:])
+
+		case strings.HasPrefix(raw, `'`):
+			j := strings.IndexByte(raw[1:], '\'')
+			if j < 0 {
+				return nil, nil, fmt.Errorf("dotenv: line %d: unterminated quoted value", line)
+			}
+			value = raw[1 : j+1]
+
+		default:
+			if j := strings.Index(raw, " #"); j >= 0 {
+				raw = raw[:j]
+			}
+			value = parseScalar(helpers.TrimRight(raw))
+		}
+
+		keys := strings.Split(envKey(name), ".")
+
+		sm, ok := subMap(m, keys[:len(keys)-1])
+		if !ok {
+			return nil, nil, fmt.Errorf("dotenv: line %d: %s conflicts with a value", line, name)
+		}
+		sm[keys[len(keys)-1]] = value
+		lines[envKey(name)] = start
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, lines, nil
+}
+
+func hasClosingQuote(s string) bool {
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return true
+		}
+	}
+	return false
+}
+
+func unquoteDotenv(s string) string {
+	b := strings.Builder{}
+	escaped := false
+
+	for _, c := range s {
+		if escaped {
+			escaped = false
+
+			switch c {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '\\':
+			escaped = true
+		case '"':
+			return b.String()
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/olegshs/go-tools/helpers"
+)
+
+// decodeIni читает файл INI.
+//
+// Названия разделов могут содержать точки, например [database.default].
+// Ключи вида "name[]" собираются в массив. Комментарии начинаются с ";" или "#".
+func decodeIni(r io.Reader) (map[string]interface{}, error) {
+	m, _, err := parseIni(r)
+	return m, err
+}
+
+func iniLines(b []byte) map[string]int {
+	_, lines, _ := parseIni(bytes.NewReader(b))
+	return lines
+}
+
+func parseIni(r io.Reader) (map[string]interface{}, map[string]int, error) {
+	m := map[string]interface{}{}
+	section := m
+	sectionName := ""
+	lines := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		s := helpers.Trim(scanner.Text())
+		if s == "" || s[0] == ';' || s[0] == '#' {
+			continue
+		}
+
+		if s[0] == '[' {
+			if s[len(s)-1] != ']' {
+				return nil, nil, fmt.Errorf("ini: line %d: invalid section", line)
+			}
+
+			name := helpers.Trim(s[1 : len(s)-1])
+			if name == "" {
+				return nil, nil, fmt.Errorf("ini: line %d: empty section name", line)
+			}
+
+			var ok bool
+			section, ok = subMap(m, strings.Split(name, "."))
+			if !ok {
+				return nil, nil, fmt.Errorf("ini: line %d: section %s conflicts with a value", line, name)
+			}
+			sectionName = name
+			continue
+		}
+
+		i := strings.IndexAny(s, "=:")
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("ini: line %d: expected key = value", line)
+		}
+
+		key := helpers.Trim(s[:i])
+		value := parseIniValue(helpers.Trim(s[i+1:]))
+
+		if strings.HasSuffix(key, "[]") {
+			key = helpers.Trim(key[:len(key)-2])
+			a, _ := section[key].([]interface{})
+			section[key] = append(a, value)
+		} else {
+			section[key] = value
+		}
+
+		if _, ok := lines[joinKey(sectionName, key)]; !ok {
+			lines[joinKey(sectionName, key)] = line
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, lines, nil
+}
+
+func parseIniValue(s string) interface{} {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') {
+		if i := strings.IndexByte(s[1:], s[0]); i >= 0 {
+			return s[1 : i+1]
+		}
+	}
+
+	for _, sep := range []string{" ;", "\t;", " #", "\t#"} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = helpers.TrimRight(s[:i])
+		}
+	}
+
+	return parseScalar(s)
+}
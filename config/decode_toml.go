@@ -0,0 +1,654 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	tomlDateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlTimeRegexp = regexp.MustCompile(`^\d{2}:\d{2}`)
+)
+
+// decodeToml читает файл TOML (https://toml.io/en/v1.0.0).
+//
+// Дата и время возвращаются строками, которые преобразуются функциями пакета typeconv.
+func decodeToml(r io.Reader) (map[string]interface{}, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newTomlParser(b)
+
+	err = p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.root, nil
+}
+
+func tomlLines(b []byte) map[string]int {
+	p := newTomlParser(b)
+	p.parse()
+
+	return p.lines
+}
+
+func newTomlParser(b []byte) *tomlParser {
+	p := &tomlParser{
+		s:       string(b),
+		root:    map[string]interface{}{},
+		defined: map[string]bool{},
+		path:    []string{},
+		lines:   map[string]int{},
+	}
+	p.current = p.root
+
+	return p
+}
+
+type tomlParser struct {
+	s   string
+	pos int
+
+	// Номер строки для позиции linePos: позиция только увеличивается,
+	// поэтому при каждом вызове line() просматривается только новая часть текста.
+	lineNum int
+	linePos int
+
+	root    map[string]interface{}
+	current map[string]interface{}
+
+	// Таблицы, объявленные заголовком [name], повторное объявление запрещено.
+	defined map[string]bool
+
+	// Путь к текущей таблице и номера строк ключей.
+	// Для элементов массивов таблиц путь равен nil, номера строк не запоминаются.
+	path  []string
+	lines map[string]int
+}
+
+type tomlError struct {
+	line int
+	msg  string
+}
+
+func (e *tomlError) Error() string {
+	return fmt.Sprintf("toml: line %d: %s", e.line, e.msg)
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) error {
+	return &tomlError{
+		line: p.line(),
+		msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+func (p *tomlParser) line() int {
+	if p.pos > p.linePos {
+		p.lineNum += strings.Count(p.s[p.linePos:p.pos], "\n")
+		p.linePos = p.pos
+	}
+	return p.lineNum + 1
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			err = p.parseTableHeader()
+		} else {
+			err = p.parseKeyValue(p.current, p.path)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = p.expectLineEnd()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *tomlParser) parseTableHeader() error {
+	isArray := strings.HasPrefix(p.s[p.pos:], "[[")
+	if isArray {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+
+	p.skipBlank(false)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+
+	closing := "]"
+	if isArray {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.pos:], closing) {
+		return p.errorf("expected %s", closing)
+	}
+	p.pos += len(closing)
+
+	if isArray {
+		parent, err := p.table(keys[:len(keys)-1])
+		if err != nil {
+			return err
+		}
+
+		last := keys[len(keys)-1]
+		var a []interface{}
+		switch t := parent[last].(type) {
+		case nil:
+			// new array
+		case []interface{}:
+			a = t
+		default:
+			return p.errorf("%s is not an array of tables", strings.Join(keys, "."))
+		}
+
+		p.current = map[string]interface{}{}
+		parent[last] = append(a, p.current)
+		p.path = nil
+		return nil
+	}
+
+	name := strings.Join(keys, "\x00")
+	if p.defined[name] {
+		return p.errorf("table %s is already defined", strings.Join(keys, "."))
+	}
+	p.defined[name] = true
+
+	p.current, err = p.table(keys)
+	p.path = keys
+	return err
+}
+
+// table возвращает таблицу по составному ключу, создавая недостающие таблицы.
+// Для массивов таблиц используется последний элемент.
+func (p *tomlParser) table(keys []string) (map[string]interface{}, error) {
+	m := p.root
+	for _, k := range keys {
+		switch t := m[k].(type) {
+		case nil:
+			sub := map[string]interface{}{}
+			m[k] = sub
+			m = sub
+		case map[string]interface{}:
+			m = t
+		case []interface{}:
+			if len(t) == 0 {
+				return nil, p.errorf("%s is not a table", k)
+			}
+			sub, ok := t[len(t)-1].(map[string]interface{})
+			if !ok {
+				return nil, p.errorf("%s is not a table", k)
+			}
+			m = sub
+		default:
+			return nil, p.errorf("%s is not a table", k)
+		}
+	}
+
+	return m, nil
+}
+
+// parseKeyValue читает пару ключ-значение в таблицу m.
+// Если path != nil, то запоминается номер строки ключа относительно корня файла.
+func (p *tomlParser) parseKeyValue(m map[string]interface{}, path []string) error {
+	line := p.line()
+
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	p.skipBlank(false)
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected =")
+	}
+	p.pos++
+	p.skipBlank(false)
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	sub, ok := subMap(m, keys[:len(keys)-1])
+	if !ok {
+		return p.errorf("%s is not a table", strings.Join(keys[:len(keys)-1], "."))
+	}
+
+	last := keys[len(keys)-1]
+	if _, exists := sub[last]; exists {
+		return p.errorf("key %s is already defined", strings.Join(keys, "."))
+	}
+	sub[last] = value
+
+	if path != nil {
+		p.lines[strings.Join(append(path[:len(path):len(path)], keys...), ".")] = line
+	}
+
+	return nil
+}
+
+func (p *tomlParser) parseKey() ([]string, error) {
+	keys := []string{}
+
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+
+		var (
+			k   string
+			err error
+		)
+
+		switch p.peek() {
+		case '"':
+			k, err = p.parseBasicString()
+		case '\'':
+			k, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isTomlBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("expected key")
+			}
+			k = p.s[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.s[p.pos:], `"""`) {
+			return p.parseMultilineString(`"""`, true)
+		}
+		return p.parseBasicString()
+
+	case '\'':
+		if strings.HasPrefix(p.s[p.pos:], `'''`) {
+			return p.parseMultilineString(`'''`, false)
+		}
+		return p.parseLiteralString()
+
+	case '[':
+		return p.parseArray()
+
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	return p.parseScalar()
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.pos++
+	a := []interface{}{}
+
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return a, nil
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return a, nil
+		default:
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.pos++
+	m := map[string]interface{}{}
+
+	p.skipBlank(false)
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return m, nil
+	}
+
+	for {
+		err := p.parseKeyValue(m, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return m, nil
+		default:
+			return nil, p.errorf("expected , or }")
+		}
+	}
+}
+
+func (p *tomlParser) parseScalar() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+
+	s := p.s[start:p.pos]
+
+	// дата и время могут быть разделены пробелом
+	if tomlDateRegexp.MatchString(s) && p.pos+1 < len(p.s) && p.s[p.pos] == ' ' &&
+		tomlTimeRegexp.MatchString(p.s[p.pos+1:]) {
+		p.pos++
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+		return p.s[start:p.pos], nil
+	}
+
+	switch s {
+	case "":
+		return nil, p.errorf("expected value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		f, _ := strconv.ParseFloat(s, 64)
+		return f, nil
+	}
+
+	if tomlDateRegexp.MatchString(s[:min(len(s), 10)]) || tomlTimeRegexp.MatchString(s) {
+		return s, nil
+	}
+
+	n := strings.ReplaceAll(s, "_", "")
+	if n == "" {
+		return nil, p.errorf("invalid value %s", s)
+	}
+
+	sign := ""
+	if n[0] == '+' || n[0] == '-' {
+		sign, n = n[:1], n[1:]
+	}
+
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(n, prefix) {
+			i, err := strconv.ParseInt(sign+n[2:], base, 0)
+			if err != nil {
+				return nil, p.errorf("invalid number %s", s)
+			}
+			return int(i), nil
+		}
+	}
+
+	if i, err := strconv.ParseInt(sign+n, 10, 0); err == nil {
+		return int(i), nil
+	}
+
+	f, err := strconv.ParseFloat(sign+n, 64)
+	if err != nil {
+		return nil, p.errorf("invalid value %s", s)
+	}
+
+	return f, nil
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++
+	b := strings.Builder{}
+
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			err := p.parseEscape(&b)
+			if err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++
+	start := p.pos
+
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if p.peek() == '\'' {
+			s := p.s[start:p.pos]
+			p.pos++
+			return s, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseMultilineString(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+
+	// перевод строки сразу после открывающих кавычек не учитывается
+	if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+		p.pos += 2
+	} else if strings.HasPrefix(p.s[p.pos:], "\n") {
+		p.pos++
+	}
+
+	b := strings.Builder{}
+
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+
+		if strings.HasPrefix(p.s[p.pos:], delim) {
+			p.pos += len(delim)
+
+			// до двух кавычек могут стоять непосредственно перед закрывающими
+			for i := 0; i < 2 && !p.eof() && p.peek() == delim[0]; i++ {
+				b.WriteByte(delim[0])
+				p.pos++
+			}
+
+			return b.String(), nil
+		}
+
+		c := p.peek()
+		if escapes && c == '\\' {
+			rest := strings.TrimLeft(p.s[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				// обратная косая черта в конце строки удаляет перевод строки и следующие пробелы
+				p.pos = len(p.s) - len(rest)
+				p.skipBlank(true)
+				continue
+			}
+
+			err := p.parseEscape(&b)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder) error {
+	p.pos++
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+
+	c := p.peek()
+	p.pos++
+
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte('\x1b')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+
+		code, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+
+		b.WriteRune(rune(code))
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+
+	return nil
+}
+
+// skipBlank пропускает пробелы и комментарии, а также переводы строк, если newlines == true.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t':
+			p.pos++
+		case '\r', '\n':
+			if !newlines {
+				return
+			}
+			p.pos++
+		case '#':
+			if !newlines {
+				return
+			}
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) expectLineEnd() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+		return nil
+	}
+
+	if p.peek() == '\r' || p.peek() == '\n' {
+		return nil
+	}
+
+	return p.errorf("unexpected %q", p.peek())
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func isTomlBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
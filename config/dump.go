@@ -0,0 +1,266 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/olegshs/go-tools/helpers"
+)
+
+// Форматы вывода конфигурации.
+const (
+	FormatYaml = "yaml"
+	FormatJson = "json"
+)
+
+const (
+	maskedValue = "******"
+)
+
+var (
+	// ErrUnknownFormat возвращается, если формат вывода не поддерживается.
+	ErrUnknownFormat = errors.New("unknown format")
+
+	// SecretKeyRegexp определяет названия параметров, значения которых скрываются функцией DumpMasked.
+	SecretKeyRegexp = regexp.MustCompile(`(?i)(pass(word|wd)?|secret|token|api_?key|private_?key|credentials?|salt)$`)
+)
+
+// Значение параметра с указанием происхождения, для вывода в формате JSON.
+type dumpValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source,omitempty"`
+}
+
+type dumper struct {
+	data    map[string]interface{}
+	sources map[string]Source
+	secrets map[string]bool
+	mask    bool
+}
+
+// Dump выводит действующую конфигурацию в формате YAML или JSON,
+// указывая для каждого значения его происхождение.
+// Расшифрованные значения параметров всегда скрываются, см. IsSecret.
+func (s *Store) Dump(w io.Writer, format string) error {
+	return s.dump(w, format, false)
+}
+
+// DumpMasked работает так же, как Dump, но скрывает значения параметров,
+// названия которых соответствуют SecretKeyRegexp.
+func (s *Store) DumpMasked(w io.Writer, format string) error {
+	return s.dump(w, format, true)
+}
+
+func (s *Store) dump(w io.Writer, format string, mask bool) error {
+	s.mutex.RLock()
+	d := dumper{
+		data:    map[string]interface{}{},
+		sources: make(map[string]Source, len(s.tree.sources)),
+		secrets: make(map[string]bool, len(s.tree.secrets)),
+		mask:    mask,
+	}
+	for k, v := range s.tree.data {
+		if !strings.Contains(k, ".") {
+			d.data[k] = v
+		}
+	}
+	for k, v := range s.tree.sources {
+		d.sources[k] = v
+	}
+	for k, v := range s.tree.secrets {
+		d.secrets[k] = v
+	}
+	s.mutex.RUnlock()
+
+	switch format {
+	case FormatYaml:
+		return d.yaml(w, d.data, "", "")
+	case FormatJson:
+		b, err := json.MarshalIndent(d.json(d.data, ""), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+func (d *dumper) yaml(w io.Writer, m map[string]interface{}, key string, indent string) error {
+	for _, k := range helpers.Map[string, interface{}](m).SortedKeys() {
+		fullKey := joinKey(key, k)
+		value := d.value(fullKey, m[k])
+
+		name, err := yamlScalar(k)
+		if err != nil {
+			return err
+		}
+
+		switch t := value.(type) {
+		case map[string]interface{}:
+			if len(t) > 0 {
+				_, err = fmt.Fprintf(w, "%s%s:\n", indent, name)
+				if err != nil {
+					return err
+				}
+
+				err = d.yaml(w, t, fullKey, indent+"  ")
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+		case []interface{}:
+			if len(t) > 0 {
+				b, err := yaml.Marshal(t)
+				if err != nil {
+					return err
+				}
+
+				_, err = fmt.Fprintf(w, "%s%s:%s\n", indent, name, d.comment(fullKey))
+				if err != nil {
+					return err
+				}
+
+				for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+					_, err = fmt.Fprintf(w, "%s  %s\n", indent, line)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+
+		s, err := yamlScalar(value)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "%s%s: %s%s\n", indent, name, s, d.comment(fullKey))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *dumper) json(m map[string]interface{}, key string) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+
+	for k, v := range m {
+		fullKey := joinKey(key, k)
+		value := d.value(fullKey, v)
+
+		if t, ok := value.(map[string]interface{}); ok && len(t) > 0 {
+			result[k] = d.json(t, fullKey)
+			continue
+		}
+
+		dv := dumpValue{Value: value}
+		if src, ok := d.sources[fullKey]; ok {
+			dv.Source = src.String()
+		}
+		result[k] = dv
+	}
+
+	return result
+}
+
+func (d *dumper) comment(key string) string {
+	src, ok := d.sources[key]
+	if !ok {
+		return ""
+	}
+
+	return "  # " + src.String()
+}
+
+// value возвращает значение для вывода, скрывая секретные значения, в том числе внутри массивов.
+func (d *dumper) value(key string, value interface{}) interface{} {
+	if d.secrets[key] {
+		return maskedValue
+	}
+
+	if !d.mask {
+		return value
+	}
+
+	return maskSecrets(key, value)
+}
+
+func maskSecrets(key string, value interface{}) interface{} {
+	if isSecretKey(key) {
+		if value == nil {
+			return nil
+		}
+		return maskedValue
+	}
+
+	switch t := value.(type) {
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = maskSecrets("", v)
+		}
+		return a
+
+	case map[string]interface{}:
+		if key != "" {
+			return t
+		}
+
+		// элементы массивов проверяются целиком, так как для них не ведётся происхождение
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			if isSecretKey(k) {
+				m[k] = maskedValue
+			} else {
+				m[k] = maskSecrets("", v)
+			}
+		}
+		return m
+	}
+
+	return value
+}
+
+func isSecretKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+
+	return SecretKeyRegexp.MatchString(key)
+}
+
+func yamlScalar(value interface{}) (string, error) {
+	switch t := value.(type) {
+	case json.Number:
+		return string(t), nil
+	case string:
+		if strings.ContainsAny(t, "\r\n") {
+			b, err := json.Marshal(t)
+			return string(b), err
+		}
+	}
+
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\n"), nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/olegshs/go-tools/helpers/typeconv"
+)
+
+const (
+	// Разделитель уровней вложенности в названиях переменных окружения.
+	envKeySeparator = "__"
+)
+
+var (
+	envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+)
+
+// LoadEnv устанавливает значения параметров из переменных окружения с указанным префиксом.
+// Название параметра получается из названия переменной: префикс отбрасывается,
+// двойное подчёркивание заменяется точкой, буквы приводятся к нижнему регистру.
+// Например, переменная APP_DATABASE__DEFAULT__HOST с префиксом APP
+// устанавливает параметр database.default.host.
+func (s *Store) LoadEnv(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	op := operation{envPrefix: prefix}
+	op.apply(s.tree)
+
+	s.record(op)
+}
+
+// SetEnvPrefix задаёт префикс переменных окружения, значения которых
+// переопределяют параметры, загружаемые функциями Load и LoadAll.
+// Если префикс не задан, переменные окружения не используются.
+func (s *Store) SetEnvPrefix(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.envPrefix = prefix
+}
+
+func (t *tree) loadEnv(prefix string, section string) {
+	for key, env := range envVars(prefix) {
+		if section != "" && key != section && !strings.HasPrefix(key, section+".") {
+			continue
+		}
+
+		k, v := nest(key, coerce(t.data[key], env.value))
+		set(t.data, k, v)
+		t.sources[key] = Source{Layer: LayerEnv, Env: env.name}
+	}
+}
+
+// nest преобразует параметр с составным названием во вложенные карты,
+// чтобы при установке значения обновились и все родительские разделы.
+func nest(key string, value interface{}) (string, interface{}) {
+	a := strings.Split(key, ".")
+	for i := len(a) - 1; i > 0; i-- {
+		value = map[string]interface{}{
+			a[i]: value,
+		}
+	}
+
+	return a[0], value
+}
+
+// Переменная окружения.
+type envVar struct {
+	name  string
+	value string
+}
+
+func envVars(prefix string) map[string]envVar {
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+
+	m := map[string]envVar{}
+	for _, env := range os.Environ() {
+		a := strings.SplitN(env, "=", 2)
+		if len(a) != 2 || !strings.HasPrefix(a[0], prefix) {
+			continue
+		}
+
+		name := a[0][len(prefix):]
+		if name == "" {
+			continue
+		}
+
+		m[envKey(name)] = envVar{a[0], a[1]}
+	}
+
+	return m
+}
+
+// envKey преобразует название переменной окружения в название параметра.
+func envKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, envKeySeparator, "."))
+}
+
+// coerce преобразует строку из переменной окружения к типу текущего значения параметра.
+func coerce(current interface{}, s string) interface{} {
+	switch current.(type) {
+	case nil, string, map[string]interface{}, []interface{}:
+		return s
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return typeconv.Bool(s)
+		}
+		return b
+	case json.Number:
+		// строка, которая не является числом JSON, сохраняется как есть
+		if _, err := strconv.ParseFloat(s, 64); err != nil || !json.Valid([]byte(s)) {
+			return s
+		}
+		return json.Number(s)
+	}
+
+	t := reflect.TypeOf(current).String()
+	if !typeconv.CanTo(t) {
+		return s
+	}
+
+	return typeconv.To(t, s)
+}
+
+// interpolate заменяет в строковых значениях ссылки вида ${VAR} и ${VAR:-default}
+// значениями переменных окружения.
+func interpolate(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, v := range t {
+			t[k] = interpolate(v)
+		}
+		return t
+	case []interface{}:
+		for i, v := range t {
+			t[i] = interpolate(v)
+		}
+		return t
+	case string:
+		return expandEnv(t)
+	default:
+		return t
+	}
+}
+
+func expandEnv(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	return envVarRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		a := envVarRegexp.FindStringSubmatch(ref)
+
+		value, ok := os.LookupEnv(a[1])
+		if (!ok || value == "") && a[2] != "" {
+			return a[3]
+		}
+
+		return value
+	})
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ProfileEnv — переменная окружения с названием профиля конфигурации,
+	// который используется, если профиль не установлен функцией SetProfile.
+	ProfileEnv = "CONFIG_PROFILE"
+
+	// IncludeKey — параметр в корне файла конфигурации, содержащий имя файла
+	// или массив имён файлов, которые загружаются перед ним.
+	IncludeKey = "include"
+)
+
+// SetProfile устанавливает профиль конфигурации, например "production" или "test".
+// Для файла conf/app.yaml профиль задаёт дополнительный файл conf/<profile>/app.yaml.
+// Профиль применяется к файлам, загружаемым после вызова функции,
+// и ко всем файлам после перезагрузки, см. Reload.
+func (s *Store) SetProfile(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.profile = name
+	s.tree.profile = name
+}
+
+// Profile возвращает название действующего профиля конфигурации.
+func (s *Store) Profile() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.tree.currentProfile()
+}
+
+func (t *tree) currentProfile() string {
+	if t.profile != "" {
+		return t.profile
+	}
+
+	return os.Getenv(ProfileEnv)
+}
+
+func profileFilename(filename string, profile string) string {
+	dir := path.Dir(filename)
+	base := path.Base(filename)
+	return filepath.Join(dir, profile, base)
+}
+
+// includes извлекает из корня файла список подключаемых файлов.
+// Относительные пути отсчитываются от директории файла filename.
+func includes(filename string, m map[string]interface{}) ([]string, error) {
+	v, ok := m[IncludeKey]
+	if !ok {
+		return nil, nil
+	}
+	delete(m, IncludeKey)
+
+	var names []string
+
+	switch t := v.(type) {
+	case string:
+		names = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s: expected a file name", filename, IncludeKey)
+			}
+			names = append(names, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %s: expected a file name", filename, IncludeKey)
+	}
+
+	dir := filepath.Dir(filename)
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		files = append(files, AbsPath(name))
+	}
+
+	return files, nil
+}
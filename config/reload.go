@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/olegshs/go-tools/events"
+	"github.com/olegshs/go-tools/helpers"
+)
+
+// Отметка о состоянии файла, по изменению которой определяется необходимость перезагрузки.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Events возвращает диспетчер событий об изменении параметров.
+func (s *Store) Events() *events.Dispatcher {
+	return s.events
+}
+
+// ChangeEvent возвращает событие об изменении параметра или раздела, (key string).
+// Событие для раздела происходит при изменении любого из вложенных в него параметров.
+func ChangeEvent(key string) events.Event {
+	return events.Event("Change:" + key)
+}
+
+// OnChange добавляет функцию, которая будет вызвана после перезагрузки,
+// если значение параметра или раздела изменилось.
+func (s *Store) OnChange(key string, f func(key string)) {
+	s.events.AddListener(ChangeEvent(key), f)
+}
+
+// Reload повторно загружает все файлы, загруженные ранее функциями Load и LoadAll,
+// повторяет изменения, сделанные функциями Set и LoadEnv,
+// затем заменяет текущую конфигурацию новой и сообщает об изменившихся параметрах.
+// В случае ошибки текущая конфигурация остаётся без изменений.
+func (s *Store) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	s.mutex.RLock()
+	ops := make([]operation, len(s.history))
+	copy(ops, s.history)
+	seq := s.seq
+	keyring := s.keyring
+	profile := s.profile
+	s.mutex.RUnlock()
+
+	newTree := newTree(keyring, profile)
+	for _, op := range ops {
+		err := op.apply(newTree)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	for _, op := range s.history {
+		if op.seq <= seq {
+			continue
+		}
+		err := op.apply(newTree)
+		if err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+	}
+	oldTree := s.tree
+	s.tree = newTree
+	s.mutex.Unlock()
+
+	for _, key := range changedKeys(oldTree.data, newTree.data) {
+		s.events.DispatchSync(ChangeEvent(key), key)
+	}
+
+	return nil
+}
+
+// Watch запускает проверку файлов конфигурации с заданным интервалом.
+// Если какой-либо из файлов, в том числе из поддиректории "local", изменился,
+// то конфигурация перезагружается функцией Reload.
+func (s *Store) Watch(interval time.Duration) {
+	s.watcherMutex.Lock()
+	defer s.watcherMutex.Unlock()
+
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+
+	s.watcherStamps = s.fileStamps()
+	s.watcher = helpers.NewInterval(interval, s.checkFiles)
+	s.watcher.Start()
+}
+
+// Unwatch останавливает проверку файлов конфигурации.
+func (s *Store) Unwatch() {
+	s.watcherMutex.Lock()
+	defer s.watcherMutex.Unlock()
+
+	if s.watcher == nil {
+		return
+	}
+
+	s.watcher.Stop()
+	s.watcher = nil
+}
+
+func (s *Store) checkFiles() {
+	stamps := s.fileStamps()
+
+	s.watcherMutex.Lock()
+	changed := !reflect.DeepEqual(stamps, s.watcherStamps)
+	s.watcherMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	err := s.Reload()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+		return
+	}
+
+	// после перезагрузки набор файлов может измениться, например при добавлении include
+	s.watcherMutex.Lock()
+	s.watcherStamps = s.fileStamps()
+	s.watcherMutex.Unlock()
+}
+
+func (s *Store) fileStamps() map[string]fileStamp {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stamps := map[string]fileStamp{}
+	for _, filename := range s.tree.files {
+		var stamp fileStamp
+		if info, err := os.Stat(filename); err == nil {
+			stamp.modTime = info.ModTime()
+			stamp.size = info.Size()
+		}
+
+		stamps[filename] = stamp
+	}
+
+	return stamps
+}
+
+func changedKeys(oldData, newData map[string]interface{}) []string {
+	keys := []string{}
+
+	for k, v := range newData {
+		if ov, ok := oldData[k]; !ok || !reflect.DeepEqual(ov, v) {
+			keys = append(keys, k)
+		}
+	}
+
+	for k := range oldData {
+		if _, ok := newData[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
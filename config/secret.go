@@ -0,0 +1,668 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/olegshs/go-tools/helpers"
+)
+
+const (
+	// SecretPrefix — префикс зашифрованных значений параметров.
+	SecretPrefix = "enc:"
+)
+
+var (
+	// SecretKeyEnv — переменная окружения с ключом шифрования в кодировке base64.
+	// Можно указать несколько ключей через запятую: первый используется для шифрования,
+	// остальные только для расшифровки, что позволяет выполнять ротацию ключей.
+	SecretKeyEnv = "CONFIG_SECRET_KEY"
+
+	// SecretKeyFileEnv — переменная окружения с путём к файлу ключей.
+	// Файл содержит ключи в кодировке base64, по одному в строке.
+	SecretKeyFileEnv = "CONFIG_SECRET_KEY_FILE"
+)
+
+var (
+	ErrNoSecretKey      = errors.New("secret key is not set")
+	ErrInvalidSecretKey = errors.New("invalid secret key: must be 16, 24 or 32 bytes")
+	ErrInvalidSecret    = errors.New("invalid secret value")
+	ErrDecryptSecret    = errors.New("unable to decrypt secret value")
+)
+
+var (
+	// тег "!secret" в начале значения, см. valueOffsets
+	yamlSecretTagRegexp = regexp.MustCompile(`^!secret[ \t]+(["']?)`)
+	// зашифрованное значение "enc:..." или "!secret ..." в начале значения, в том числе в кавычках
+	secretValueRegexp = regexp.MustCompile(`^((["']?)` + SecretPrefix + `|!secret[ \t]+(["']?))([A-Za-z0-9+/]+={0,2})(["']?)`)
+)
+
+// Keyring хранит ключи AES-GCM для шифрования значений параметров.
+// Первый ключ используется для шифрования, все ключи — для расшифровки.
+type Keyring struct {
+	ciphers []cipher.AEAD
+}
+
+// NewKeyring создаёт набор ключей. Длина каждого ключа должна составлять 16, 24 или 32 байта.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoSecretKey
+	}
+
+	k := new(Keyring)
+
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, ErrInvalidSecretKey
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		k.ciphers = append(k.ciphers, gcm)
+	}
+
+	return k, nil
+}
+
+// ParseKeyring создаёт набор ключей из строки, содержащей ключи в кодировке base64,
+// разделённые запятыми или переводами строк.
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys [][]byte
+
+	for _, item := range strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || c == '\n' || c == '\r'
+	}) {
+		item = helpers.Trim(item)
+		if item == "" || item[0] == '#' {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(item)
+		if err != nil {
+			return nil, ErrInvalidSecretKey
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewKeyring(keys...)
+}
+
+// LoadKeyring загружает набор ключей из файла, см. ParseKeyring.
+func LoadKeyring(filename string) (*Keyring, error) {
+	b, err := os.ReadFile(AbsPath(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeyring(string(b))
+}
+
+// EnvKeyring возвращает набор ключей из переменной окружения SecretKeyEnv
+// или из файла, указанного в переменной SecretKeyFileEnv.
+func EnvKeyring() (*Keyring, error) {
+	if s := os.Getenv(SecretKeyEnv); s != "" {
+		return ParseKeyring(s)
+	}
+
+	if filename := os.Getenv(SecretKeyFileEnv); filename != "" {
+		return LoadKeyring(filename)
+	}
+
+	return nil, ErrNoSecretKey
+}
+
+// GenerateKey создаёт случайный 32-байтовый ключ в кодировке base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt шифрует значение первым ключом и возвращает его с префиксом SecretPrefix.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	gcm := k.ciphers[0]
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	b := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return SecretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Decrypt расшифровывает значение, зашифрованное функцией Encrypt.
+// Префикс SecretPrefix необязателен.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretPrefix))
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+
+	for _, gcm := range k.ciphers {
+		n := gcm.NonceSize()
+		if len(b) < n+gcm.Overhead() {
+			return "", ErrInvalidSecret
+		}
+
+		plaintext, err := gcm.Open(nil, b[:n], b[n:], nil)
+		if err == nil {
+			return string(plaintext), nil
+		}
+	}
+
+	return "", ErrDecryptSecret
+}
+
+// SetKeyring устанавливает набор ключей для расшифровки значений параметров.
+// Если набор не установлен, используются ключи из переменных окружения, см. EnvKeyring.
+// Установленный набор применяется к файлам, загружаемым после вызова функции.
+func (s *Store) SetKeyring(k *Keyring) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keyring = k
+	s.tree.keyring = k
+}
+
+// IsSecret сообщает, было ли значение параметра расшифровано при загрузке.
+// Такие значения всегда скрываются функциями Dump и DumpMasked.
+func (s *Store) IsSecret(key string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.tree.secrets[key]
+}
+
+// decryptSecrets заменяет зашифрованные значения в m расшифрованными
+// и запоминает ключи таких параметров в разделе key.
+func (t *tree) decryptSecrets(key string, m map[string]interface{}) error {
+	for k, v := range m {
+		fullKey := key + "." + k
+
+		switch value := v.(type) {
+		case map[string]interface{}:
+			err := t.decryptSecrets(fullKey, value)
+			if err != nil {
+				return err
+			}
+
+		default:
+			found, err := t.decryptValue(fullKey, &value)
+			if err != nil {
+				return err
+			}
+			if found {
+				m[k] = value
+				t.secrets[fullKey] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// decryptValue расшифровывает строку или элементы массива. Текст ошибки не содержит значений.
+func (t *tree) decryptValue(key string, v *interface{}) (bool, error) {
+	switch value := (*v).(type) {
+	case string:
+		if !strings.HasPrefix(value, SecretPrefix) {
+			return false, nil
+		}
+
+		if t.keyring == nil {
+			k, err := EnvKeyring()
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", key, err)
+			}
+			t.keyring = k
+		}
+
+		plaintext, err := t.keyring.Decrypt(value)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", key, err)
+		}
+
+		*v = plaintext
+		return true, nil
+
+	case []interface{}:
+		found := false
+		for i := range value {
+			ok, err := t.decryptValue(fmt.Sprintf("%s[%d]", key, i), &value[i])
+			if err != nil {
+				return false, err
+			}
+			found = found || ok
+		}
+		return found, nil
+
+	case map[string]interface{}:
+		found := false
+		for k := range value {
+			item := value[k]
+			ok, err := t.decryptValue(key+"."+k, &item)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				value[k] = item
+				found = true
+			}
+		}
+		return found, nil
+	}
+
+	return false, nil
+}
+
+// EncryptFile шифрует значения параметров в файле конфигурации, сохраняя остальное содержимое файла.
+// Ключи указываются относительно корня файла, например "default.password".
+// Если ключи не указаны, шифруются все строковые параметры, названия которых
+// соответствуют SecretKeyRegexp. Уже зашифрованные значения не изменяются.
+func EncryptFile(filename string, k *Keyring, keys ...string) error {
+	filename = AbsPath(filename)
+	ext := path.Ext(filename)
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	m, err := decoder(ext)(bytes.NewReader(preprocessSecrets(ext, b)))
+	if err != nil {
+		return err
+	}
+
+	lines := locateLines(ext, b)
+	if lines == nil {
+		return fmt.Errorf("%s: unable to locate keys in %s files", filename, ext)
+	}
+
+	if len(keys) == 0 {
+		keys = secretKeys(m, "")
+	}
+
+	fileLines := strings.Split(string(b), "\n")
+	plaintexts := map[string]string{}
+
+	for _, key := range keys {
+		sm, ok := subMap(m, strings.Split(key, ".")[:strings.Count(key, ".")])
+		if !ok {
+			return fmt.Errorf("%s: %s: not found", filename, key)
+		}
+
+		value, ok := sm[key[strings.LastIndexByte(key, '.')+1:]].(string)
+		if !ok {
+			return fmt.Errorf("%s: %s: not a string", filename, key)
+		}
+		if strings.HasPrefix(value, SecretPrefix) {
+			continue
+		}
+
+		line, ok := lines[key]
+		if !ok {
+			return fmt.Errorf("%s: %s: unable to locate key", filename, key)
+		}
+
+		encrypted, err := k.Encrypt(value)
+		if err != nil {
+			return err
+		}
+
+		s, ok := replaceLineValue(fileLines[line-1], `"`+encrypted+`"`)
+		if !ok {
+			return fmt.Errorf("%s:%d: %s: unable to locate value", filename, line, key)
+		}
+
+		fileLines[line-1] = s
+		plaintexts[key] = value
+	}
+
+	if len(plaintexts) == 0 {
+		return nil
+	}
+
+	b = []byte(strings.Join(fileLines, "\n"))
+
+	// проверка того, что изменённый файл читается и содержит те же значения
+	m, err = decoder(ext)(bytes.NewReader(preprocessSecrets(ext, b)))
+	if err != nil {
+		return fmt.Errorf("%s: unable to encrypt values: %w", filename, err)
+	}
+	for key, plaintext := range plaintexts {
+		sm, _ := subMap(m, strings.Split(key, ".")[:strings.Count(key, ".")])
+		value, _ := sm[key[strings.LastIndexByte(key, '.')+1:]].(string)
+		if s, err := k.Decrypt(value); err != nil || s != plaintext {
+			return fmt.Errorf("%s: %s: unable to encrypt multi-line value", filename, key)
+		}
+	}
+
+	return writeFile(filename, b)
+}
+
+// RotateFile расшифровывает все зашифрованные значения в файле конфигурации
+// любым из ключей набора и шифрует их заново первым ключом.
+func RotateFile(filename string, k *Keyring) error {
+	filename = AbsPath(filename)
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var rotateErr error
+	b = replaceValues(b, func(value string) (int, string) {
+		if rotateErr != nil {
+			return 0, ""
+		}
+
+		prefix, data, n := secretValue(value)
+		if n == 0 {
+			return 0, ""
+		}
+
+		plaintext, err := k.Decrypt(data)
+		if err != nil {
+			rotateErr = err
+			return 0, ""
+		}
+
+		encrypted, err := k.Encrypt(plaintext)
+		if err != nil {
+			rotateErr = err
+			return 0, ""
+		}
+
+		return n, prefix + strings.TrimPrefix(encrypted, SecretPrefix)
+	})
+	if rotateErr != nil {
+		return fmt.Errorf("%s: %w", filename, rotateErr)
+	}
+
+	return writeFile(filename, b)
+}
+
+// preprocessSecrets заменяет в файлах YAML теги "!secret value" префиксом SecretPrefix.
+// Тег заменяется только в начале значения, но не внутри строк в кавычках и комментариев.
+func preprocessSecrets(ext string, b []byte) []byte {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		return replaceValues(b, func(value string) (int, string) {
+			a := yamlSecretTagRegexp.FindStringSubmatch(value)
+			if a == nil {
+				return 0, ""
+			}
+			return len(a[0]), a[1] + SecretPrefix
+		})
+	}
+
+	return b
+}
+
+// secretValue разбирает зашифрованное значение в начале value. Возвращает часть перед данными
+// ("enc:", "\"enc:" или "!secret "), данные в кодировке base64 и длину разобранной части.
+// Если значение не зашифровано или продолжается после данных, то возвращается нулевая длина.
+func secretValue(value string) (string, string, int) {
+	a := secretValueRegexp.FindStringSubmatch(value)
+	if a == nil {
+		return "", "", 0
+	}
+
+	// открывающая и закрывающая кавычки должны совпадать
+	if a[2]+a[3] != a[5] {
+		return "", "", 0
+	}
+
+	rest := value[len(a[0]):]
+	if rest != "" && strings.IndexByte(" \t\r,]}", rest[0]) < 0 {
+		return "", "", 0
+	}
+
+	return a[1], a[4], len(a[1]) + len(a[4])
+}
+
+// replaceValues заменяет начало значений параметров в тексте файла конфигурации,
+// см. valueOffsets. Функция f получает строку, начиная со значения, и возвращает
+// длину заменяемой части и замену; нулевая длина оставляет значение без изменений.
+func replaceValues(b []byte, f func(value string) (int, string)) []byte {
+	lines := strings.Split(string(b), "\n")
+
+	for i, line := range lines {
+		offsets := valueOffsets(line)
+
+		// замена с конца строки сохраняет позиции предыдущих значений
+		for j := len(offsets) - 1; j >= 0; j-- {
+			k := offsets[j]
+			if n, s := f(line[k:]); n > 0 {
+				line = line[:k] + s + line[k+n:]
+			}
+		}
+
+		lines[i] = line
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// valueOffsets возвращает позиции начала значений в строке файла конфигурации:
+// начало строки, позицию после разделителя ключа и значения, маркера элемента списка YAML,
+// а также после скобки или запятой встроенного списка. Строки в кавычках
+// и комментарии пропускаются.
+func valueOffsets(line string) []int {
+	var (
+		offsets   []int
+		quote     byte
+		depth     int
+		separated bool
+		start     = true
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		if quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if c == ' ' || c == '\t' || c == '\r' {
+			continue
+		}
+		if (c == '#' || c == ';') && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			break
+		}
+
+		next := byte(' ')
+		if i+1 < len(line) {
+			next = line[i+1]
+		}
+
+		if start {
+			if c == '-' && (next == ' ' || next == '\t') {
+				continue
+			}
+			offsets = append(offsets, i)
+			start = false
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+			start = true
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth > 0:
+			start = true
+		case c == '=' && !separated:
+			separated = true
+			start = true
+		case c == ':' && (!separated || depth > 0) && strings.IndexByte(" \t\"'", next) >= 0:
+			separated = true
+			start = true
+		}
+	}
+
+	return offsets
+}
+
+func secretKeys(m map[string]interface{}, key string) []string {
+	var keys []string
+
+	for _, k := range helpers.Map[string, interface{}](m).SortedKeys() {
+		fullKey := joinKey(key, k)
+
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			keys = append(keys, secretKeys(v, fullKey)...)
+		case string:
+			if isSecretKey(fullKey) && !strings.HasPrefix(v, SecretPrefix) {
+				keys = append(keys, fullKey)
+			}
+		}
+	}
+
+	return keys
+}
+
+// replaceLineValue заменяет значение в строке вида "key: value", "key = value" или "KEY=value",
+// сохраняя ключ, комментарий и завершающую запятую.
+func replaceLineValue(line string, value string) (string, bool) {
+	i := separatorIndex(line)
+	if i < 0 {
+		return "", false
+	}
+
+	start := i + 1
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+	if start == len(line) {
+		return "", false
+	}
+
+	end := len(line)
+
+	switch c := line[start]; c {
+	case '"', '\'':
+		j := closingQuote(line[start+1:], c)
+		if j < 0 {
+			return "", false
+		}
+		end = start + 1 + j + 1
+
+	case '|', '>', '[', '{':
+		return "", false
+
+	default:
+		for _, sep := range []string{" #", "\t#", " ;", ","} {
+			if j := strings.Index(line[start:], sep); j >= 0 && start+j < end {
+				end = start + j
+			}
+		}
+		end = start + len(helpers.TrimRight(line[start:end]))
+	}
+
+	return line[:start] + value + line[end:], true
+}
+
+// separatorIndex находит разделитель ключа и значения за пределами кавычек.
+func separatorIndex(line string) int {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=' || c == ':' && (i+1 == len(line) || strings.IndexByte(" \t\"'", line[i+1]) >= 0):
+			return i
+		}
+	}
+
+	return -1
+}
+
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+
+	return -1
+}
+
+// writeFile заменяет содержимое файла через временный файл, сохраняя права доступа.
+func writeFile(filename string, b []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(f.Name(), info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"io"
+	"time"
+
+	"github.com/olegshs/go-tools/events"
+)
+
+var (
+	defaultStore = NewStore()
+)
+
+// Default возвращает хранилище по умолчанию, с которым работают функции пакета.
+func Default() *Store {
+	return defaultStore
+}
+
+// Load загружает в указанный раздел конфигурацию из файла.
+// Формат файла определяется по расширению, см. RegisterDecoder.
+// Если в директории с файлом есть поддиректория "local",
+// то из неё будет загружен файл с тем же именем, после загрузки указанного файла.
+func Load(key string, filename string) error {
+	return defaultStore.Load(key, filename)
+}
+
+// LoadAll загружает конфигурации из всех файлов,
+// которые соответствуют указанной маске. Файлы могут быть в разных форматах.
+// Имена файлов считаются именами разделов.
+func LoadAll(pattern string) error {
+	return defaultStore.LoadAll(pattern)
+}
+
+// LoadEnv устанавливает значения параметров из переменных окружения с указанным префиксом.
+func LoadEnv(prefix string) {
+	defaultStore.LoadEnv(prefix)
+}
+
+// SetEnvPrefix задаёт префикс переменных окружения, значения которых
+// переопределяют параметры, загружаемые функциями Load и LoadAll.
+func SetEnvPrefix(prefix string) {
+	defaultStore.SetEnvPrefix(prefix)
+}
+
+// Set устанавливает значение параметра.
+func Set(key string, value interface{}) {
+	defaultStore.Set(key, value)
+}
+
+// Exists проверяет существование параметра.
+func Exists(key string) bool {
+	return defaultStore.Exists(key)
+}
+
+// Get возвращает значение параметра.
+func Get(key string, defaultValue interface{}) interface{} {
+	return defaultStore.Get(key, defaultValue)
+}
+
+// GetBool возвращает значение параметра с преобразованием в булев тип.
+func GetBool(key string, defaultValue bool) bool {
+	return defaultStore.GetBool(key, defaultValue)
+}
+
+// GetInt возвращает значение параметра с преобразованием в целое число.
+func GetInt(key string, defaultValue int) int {
+	return defaultStore.GetInt(key, defaultValue)
+}
+
+// GetString возвращает значение параметра с преобразованием в строку.
+func GetString(key string, defaultValue string) string {
+	return defaultStore.GetString(key, defaultValue)
+}
+
+// GetStruct копирует значения раздела в структуру.
+func GetStruct(key string, dst interface{}) {
+	defaultStore.GetStruct(key, dst)
+}
+
+// GetSlice копирует значения раздела в массив.
+func GetSlice(key string, dst interface{}) {
+	defaultStore.GetSlice(key, dst)
+}
+
+// GetStructValid проверяет значения раздела по правилам из тегов validate
+// и, если ошибок нет, копирует их в структуру.
+func GetStructValid(key string, dst interface{}) error {
+	return defaultStore.GetStructValid(key, dst)
+}
+
+// GetStructStrict работает так же, как GetStructValid,
+// но дополнительно считает ошибкой неизвестные параметры.
+func GetStructStrict(key string, dst interface{}) error {
+	return defaultStore.GetStructStrict(key, dst)
+}
+
+// Reload повторно загружает конфигурацию и сообщает об изменившихся параметрах.
+func Reload() error {
+	return defaultStore.Reload()
+}
+
+// Watch запускает проверку файлов конфигурации с заданным интервалом.
+func Watch(interval time.Duration) {
+	defaultStore.Watch(interval)
+}
+
+// Unwatch останавливает проверку файлов конфигурации.
+func Unwatch() {
+	defaultStore.Unwatch()
+}
+
+// Events возвращает диспетчер событий об изменении параметров.
+func Events() *events.Dispatcher {
+	return defaultStore.Events()
+}
+
+// OnChange добавляет функцию, которая будет вызвана после перезагрузки,
+// если значение параметра или раздела изменилось.
+func OnChange(key string, f func(key string)) {
+	defaultStore.OnChange(key, f)
+}
+
+// SourceOf возвращает происхождение значения параметра.
+func SourceOf(key string) (Source, bool) {
+	return defaultStore.Source(key)
+}
+
+// Dump выводит действующую конфигурацию с указанием происхождения значений.
+func Dump(w io.Writer, format string) error {
+	return defaultStore.Dump(w, format)
+}
+
+// DumpMasked выводит действующую конфигурацию, скрывая секретные значения.
+func DumpMasked(w io.Writer, format string) error {
+	return defaultStore.DumpMasked(w, format)
+}
+
+// SetKeyring устанавливает набор ключей для расшифровки значений параметров.
+func SetKeyring(k *Keyring) {
+	defaultStore.SetKeyring(k)
+}
+
+// IsSecret сообщает, было ли значение параметра расшифровано при загрузке.
+func IsSecret(key string) bool {
+	return defaultStore.IsSecret(key)
+}
+
+// SetProfile устанавливает профиль конфигурации.
+func SetProfile(name string) {
+	defaultStore.SetProfile(name)
+}
+
+// Profile возвращает название действующего профиля конфигурации.
+func Profile() string {
+	return defaultStore.Profile()
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Слои конфигурации, из которых может быть получено значение параметра.
+const (
+	LayerFile    = "file"    // основной файл, загруженный функцией Load или LoadAll
+	LayerProfile = "profile" // файл из поддиректории профиля, см. SetProfile
+	LayerLocal   = "local"   // файл из поддиректории "local"
+	LayerEnv     = "env"     // переменная окружения
+	LayerSet     = "set"     // значение, установленное функцией Set
+)
+
+var (
+	yamlKeyRegexp = regexp.MustCompile(`^(\s*)(?:"([^"]+)"|'([^']+)'|([^\s#'"{}\[\],&*!|>%@` + "`" + `-][^:#]*?))\s*:(?:\s|$)`)
+)
+
+// Source описывает происхождение значения параметра.
+type Source struct {
+	Layer string // слой конфигурации, например LayerFile
+	File  string // имя файла, для слоёв LayerFile, LayerProfile и LayerLocal
+	Line  int    // номер строки в файле, если он известен
+	Env   string // название переменной окружения, для слоя LayerEnv
+}
+
+func (src Source) String() string {
+	switch {
+	case src.File != "" && src.Line > 0:
+		return fmt.Sprintf("%s %s:%d", src.Layer, src.File, src.Line)
+	case src.File != "":
+		return src.Layer + " " + src.File
+	case src.Env != "":
+		return src.Layer + " " + src.Env
+	default:
+		return src.Layer
+	}
+}
+
+// Source возвращает происхождение значения параметра.
+// Происхождение известно только для конечных значений, но не для разделов.
+func (s *Store) Source(key string) (Source, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	src, ok := s.tree.sources[key]
+	return src, ok
+}
+
+// trace запоминает происхождение всех конечных значений, вложенных в value.
+// rel — ключ относительно корня файла, по которому ищется номер строки в lines.
+func trace(sources map[string]Source, key string, value interface{}, src Source, lines map[string]int, rel string) {
+	m, ok := value.(map[string]interface{})
+	if ok && len(m) > 0 {
+		for k, v := range m {
+			trace(sources, key+"."+k, v, src, lines, joinKey(rel, k))
+		}
+		return
+	}
+
+	src.Line = lineOf(lines, rel)
+	sources[key] = src
+}
+
+// lineOf возвращает номер строки ключа или ближайшего родительского раздела,
+// например для значений из вложенных таблиц TOML или массивов.
+func lineOf(lines map[string]int, key string) int {
+	for key != "" {
+		if line, ok := lines[key]; ok {
+			return line
+		}
+
+		i := strings.LastIndexByte(key, '.')
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+
+	return 0
+}
+
+// locateLines находит номера строк, в которых определены ключи файла.
+func locateLines(ext string, b []byte) map[string]int {
+	decodersMutex.RLock()
+	f, ok := lineLocators[strings.ToLower(ext)]
+	decodersMutex.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return f(b)
+}
+
+// yamlLines находит номера строк ключей в файлах YAML и JSON по отступам.
+// Поддерживается блочная запись разделов; ключи внутри массивов не учитываются.
+func yamlLines(b []byte) map[string]int {
+	type entry struct {
+		indent int
+		key    string
+	}
+
+	lines := map[string]int{}
+	stack := []entry{}
+	inList := -1
+
+	for i, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := len(line) - len(trimmed)
+
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		if inList >= 0 && indent > inList {
+			continue
+		}
+		inList = -1
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			inList = indent
+			continue
+		}
+
+		m := yamlKeyRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, entry{indent, m[2] + m[3] + m[4]})
+
+		keys := make([]string, len(stack))
+		for j, e := range stack {
+			keys[j] = e.key
+		}
+
+		path := strings.Join(keys, ".")
+		if _, ok := lines[path]; !ok {
+			lines[path] = i + 1
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olegshs/go-tools/helpers"
+	"github.com/olegshs/go-tools/helpers/structmap"
+	"github.com/olegshs/go-tools/helpers/typeconv"
+)
+
+// Название тега с правилами проверки поля.
+//
+// Правила перечисляются через запятую:
+//
+//	required     — параметр обязателен;
+//	min=N, max=N — границы значения числа или длительности, либо длины строки или массива;
+//	enum=a|b|c   — список допустимых значений;
+//	duration     — строка должна содержать длительность в формате time.ParseDuration.
+//
+// Например: `json:"port" validate:"required,min=1,max=65535"`.
+const validateTag = "validate"
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// FieldError описывает ошибку в значении параметра.
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// ValidationError содержит список всех ошибок, найденных при проверке раздела.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	a := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		a[i] = err.Error()
+	}
+
+	return "invalid configuration: " + strings.Join(a, "; ")
+}
+
+// GetStructValid проверяет значения раздела по правилам из тегов validate
+// и, если ошибок нет, копирует их в структуру.
+// Возвращает *ValidationError со списком всех найденных ошибок.
+func (s *Store) GetStructValid(key string, dst interface{}) error {
+	return s.getStructValid(key, dst, false)
+}
+
+// GetStructStrict работает так же, как GetStructValid,
+// но дополнительно считает ошибкой параметры, которым не соответствует ни одно поле структуры.
+func (s *Store) GetStructStrict(key string, dst interface{}) error {
+	return s.getStructValid(key, dst, true)
+}
+
+func (s *Store) getStructValid(key string, dst interface{}, strict bool) error {
+	m, _ := s.Get(key, nil).(map[string]interface{})
+
+	t := indirectType(reflect.TypeOf(dst))
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("%T is not a pointer to struct", dst))
+	}
+
+	v := validator{strict: strict}
+	v.validateStruct(key, m, t)
+
+	if len(v.errors) > 0 {
+		return &ValidationError{v.errors}
+	}
+
+	structmap.ToStruct(m, dst)
+	return nil
+}
+
+type validator struct {
+	strict bool
+	errors []FieldError
+}
+
+type validateRules struct {
+	required bool
+	duration bool
+	min      string
+	max      string
+	enum     []string
+}
+
+func (v *validator) addError(key string, format string, a ...interface{}) {
+	v.errors = append(v.errors, FieldError{key, fmt.Sprintf(format, a...)})
+}
+
+func (v *validator) validateStruct(key string, m map[string]interface{}, t reflect.Type) {
+	known := map[string]bool{}
+	v.validateFields(key, m, t, known)
+
+	if !v.strict {
+		return
+	}
+
+	for _, k := range helpers.Map[string, interface{}](m).SortedKeys() {
+		if !known[k] {
+			v.addError(joinKey(key, k), "unknown key")
+		}
+	}
+}
+
+func (v *validator) validateFields(key string, m map[string]interface{}, t reflect.Type, known map[string]bool) {
+	n := t.NumField()
+	for i := 0; i < n; i++ {
+		f := t.Field(i)
+
+		if f.Anonymous {
+			ft := indirectType(f.Type)
+			if ft.Kind() == reflect.Struct {
+				v.validateFields(key, m, ft, known)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		keys := structmap.FieldKeys(f)
+		if len(keys) == 0 {
+			continue
+		}
+
+		var (
+			k     = keys[0]
+			value interface{}
+		)
+		for _, fk := range keys {
+			known[fk] = true
+
+			if mv, ok := m[fk]; ok && value == nil {
+				k, value = fk, mv
+			}
+		}
+
+		rules := parseRules(f.Tag.Get(validateTag))
+
+		if value == nil {
+			if rules.required {
+				v.addError(joinKey(key, k), "is required")
+			}
+			continue
+		}
+
+		v.validateValue(joinKey(key, k), value, f.Type, rules)
+	}
+}
+
+func (v *validator) validateValue(key string, value interface{}, t reflect.Type, rules validateRules) {
+	t = indirectType(t)
+
+	switch {
+	case t == durationType:
+		d, ok := toDuration(value)
+		if !ok {
+			v.addError(key, "invalid duration %q", typeconv.String(value))
+			return
+		}
+		v.checkRange(key, float64(d), rules, parseDurationRule)
+
+	case t == timeType:
+		if typeconv.TimePtr(value) == nil {
+			v.addError(key, "invalid time %q", typeconv.String(value))
+		}
+
+	case t.Kind() == reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			v.addError(key, "expected section, got %s", typeName(value))
+			return
+		}
+		v.validateStruct(key, m, t)
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		a, ok := value.([]interface{})
+		if !ok {
+			v.validateValue(key, value, t.Elem(), validateRules{})
+			return
+		}
+		v.checkRange(key, float64(len(a)), rules, parseNumberRule)
+
+		for i, item := range a {
+			v.validateValue(fmt.Sprintf("%s[%d]", key, i), item, t.Elem(), validateRules{})
+		}
+
+	case t.Kind() == reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			v.addError(key, "expected section, got %s", typeName(value))
+			return
+		}
+		v.checkRange(key, float64(len(m)), rules, parseNumberRule)
+
+	default:
+		v.validateScalar(key, value, t, rules)
+	}
+}
+
+func (v *validator) validateScalar(key string, value interface{}, t reflect.Type, rules validateRules) {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		v.addError(key, "expected %s, got %s", t.Kind(), typeName(value))
+		return
+	}
+
+	s := typeconv.String(value)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if !isBool(value) {
+			v.addError(key, "expected bool, got %q", s)
+			return
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !isInteger(value) {
+			v.addError(key, "expected integer, got %q", s)
+			return
+		}
+		v.checkRange(key, typeconv.Float64(typeconv.Int64(value)), rules, parseNumberRule)
+
+	case reflect.Float32, reflect.Float64:
+		if !isNumber(value) {
+			v.addError(key, "expected number, got %q", s)
+			return
+		}
+		v.checkRange(key, typeconv.Float64(value), rules, parseNumberRule)
+
+	case reflect.String:
+		if rules.duration {
+			if _, err := time.ParseDuration(s); err != nil {
+				v.addError(key, "invalid duration %q", s)
+				return
+			}
+		}
+		v.checkRange(key, float64(len(s)), rules, parseNumberRule)
+	}
+
+	if len(rules.enum) > 0 && helpers.Slice[string](rules.enum).IndexOf(s) < 0 {
+		v.addError(key, "must be one of %s, got %q", strings.Join(rules.enum, ", "), s)
+	}
+}
+
+func (v *validator) checkRange(key string, value float64, rules validateRules, parse func(string) float64) {
+	if rules.min != "" && value < parse(rules.min) {
+		v.addError(key, "must be at least %s", rules.min)
+	}
+
+	if rules.max != "" && value > parse(rules.max) {
+		v.addError(key, "must be at most %s", rules.max)
+	}
+}
+
+func parseRules(tag string) validateRules {
+	var rules validateRules
+
+	for _, s := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(helpers.Trim(s), "=")
+
+		switch name {
+		case "":
+			// empty
+		case "required":
+			rules.required = true
+		case "duration":
+			rules.duration = true
+		case "min":
+			rules.min = arg
+		case "max":
+			rules.max = arg
+		case "enum":
+			rules.enum = strings.Split(arg, "|")
+		default:
+			panic("unknown validation rule: " + name)
+		}
+	}
+
+	return rules
+}
+
+func parseNumberRule(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic("invalid validation rule argument: " + s)
+	}
+	return f
+}
+
+func parseDurationRule(s string) float64 {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		panic("invalid validation rule argument: " + s)
+	}
+	return float64(d)
+}
+
+func toDuration(value interface{}) (time.Duration, bool) {
+	s, ok := value.(string)
+	if !ok {
+		if !isNumber(value) {
+			return 0, false
+		}
+		return typeconv.Duration(value), true
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+
+	return d, true
+}
+
+func isBool(value interface{}) bool {
+	switch t := value.(type) {
+	case bool:
+		return true
+	case string:
+		_, err := strconv.ParseBool(t)
+		return err == nil
+	default:
+		return isInteger(value)
+	}
+}
+
+func isInteger(value interface{}) bool {
+	switch t := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case float32, float64:
+		f := typeconv.Float64(t)
+		return f == float64(int64(f))
+	case json.Number:
+		_, err := t.Int64()
+		return err == nil
+	case string:
+		_, err := strconv.ParseInt(t, 0, 64)
+		return err == nil
+	default:
+		return false
+	}
+}
+
+func isNumber(value interface{}) bool {
+	switch t := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	case json.Number:
+		_, err := t.Float64()
+		return err == nil
+	case string:
+		_, err := strconv.ParseFloat(t, 64)
+		return err == nil
+	default:
+		return false
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "section"
+	case []interface{}:
+		return "list"
+	default:
+		return fmt.Sprintf("%q", typeconv.String(value))
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinKey(key, k string) string {
+	if key == "" {
+		return k
+	}
+	return key + "." + k
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/olegshs/go-tools/helpers/structmap"
+	"github.com/olegshs/go-tools/helpers/typeconv"
+)
+
+// Value возвращает значение параметра, преобразованное к типу T.
+// Поддерживаются скалярные типы, time.Duration, time.Time, массивы, карты со строковыми ключами
+// и структуры (см. GetStruct). Если параметр отсутствует или его структура не соответствует типу,
+// например строка вместо массива, или время не удаётся разобрать, то возвращается значение
+// по умолчанию. Скалярные значения преобразуются по правилам пакета typeconv и не приводят
+// к ошибке: например, строка "abc" для типа int даёт 0, а не значение по умолчанию.
+// Если store == nil, используется хранилище по умолчанию.
+func Value[T any](store *Store, key string, defaultValue T) T {
+	if store == nil {
+		store = defaultStore
+	}
+
+	value, ok := store.lookup(key)
+	if !ok || value == nil {
+		return defaultValue
+	}
+
+	if v, ok := value.(T); ok {
+		return v
+	}
+
+	var result T
+	if !convertValue(value, reflect.ValueOf(&result).Elem()) {
+		return defaultValue
+	}
+
+	return result
+}
+
+func convertValue(src interface{}, dst reflect.Value) bool {
+	t := dst.Type()
+
+	switch {
+	case t == durationType:
+		dst.Set(reflect.ValueOf(typeconv.Duration(src)))
+
+	case t == timeType:
+		ts := typeconv.TimePtr(src)
+		if ts == nil {
+			return false
+		}
+		dst.Set(reflect.ValueOf(*ts))
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		dst.Set(reflect.ValueOf(typeconv.Bytes(src)).Convert(t))
+
+	case t.Kind() == reflect.Interface:
+		rv := reflect.ValueOf(src)
+		if !rv.IsValid() || !rv.Type().Implements(t) {
+			return false
+		}
+		dst.Set(rv)
+
+	case t.Kind() == reflect.Slice:
+		a, ok := src.([]interface{})
+		if !ok {
+			return false
+		}
+
+		out := reflect.MakeSlice(t, len(a), len(a))
+		for i, v := range a {
+			if !convertValue(v, out.Index(i)) {
+				return false
+			}
+		}
+		dst.Set(out)
+
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		out := reflect.MakeMapWithSize(t, len(m))
+		for k, v := range m {
+			item := reflect.New(t.Elem()).Elem()
+			if !convertValue(v, item) {
+				return false
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), item)
+		}
+		dst.Set(out)
+
+	case t.Kind() == reflect.Struct:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		structmap.ToStruct(m, dst.Addr().Interface())
+
+	case t.Kind() == reflect.Ptr:
+		item := reflect.New(t.Elem())
+		if !convertValue(src, item.Elem()) {
+			return false
+		}
+		dst.Set(item)
+
+	default:
+		// для именованных типов преобразование выполняется по базовому типу
+		v := typeconv.To(t.Kind().String(), src)
+		if v == nil {
+			return false
+		}
+		dst.Set(reflect.ValueOf(v).Convert(t))
+	}
+
+	return true
+}
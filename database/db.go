@@ -74,7 +74,7 @@ func New(name string) (*DB, error) {
 	db.driver = conf.Driver
 	db.db = sqlDB
 	db.helper = helper
-	db.events = events.New()
+	db.events = events.Shared.Namespace(confKey)
 
 	if conf.Log.Enabled {
 		log := NewLog(db, conf.Log)
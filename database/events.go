@@ -4,6 +4,8 @@ import (
 	"github.com/olegshs/go-tools/events"
 )
 
+// События также отправляются в events.Shared под именами вида "database.<name>.<event>",
+// например "database.default.Query"; на все события баз данных можно подписаться по шаблону "database.**".
 const (
 	EventPing     = events.Event("Ping")     // (startTime, endTime, nil, nil, err)
 	EventExec     = events.Event("Exec")     // (startTime, endTime, query, args, err)
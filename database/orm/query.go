@@ -215,6 +215,9 @@ func (q *Query) Find(models interface{}) error {
 	}
 	defer rows.Close()
 
+	// модели сохраняются в кэш одним пакетным запросом
+	cached := map[string]interface{}{}
+
 	for rows.Next() {
 		q.clearModel()
 
@@ -224,7 +227,10 @@ func (q *Query) Find(models interface{}) error {
 		}
 
 		if len(q.columns) == 0 {
-			q.cacheSet(q.modelPrimaryKey())
+			key := q.cacheKey(q.modelPrimaryKey())
+			if key != "" {
+				cached[key] = q.modelValue.Interface()
+			}
 		}
 
 		err = q.loadRelated()
@@ -243,6 +249,10 @@ func (q *Query) Find(models interface{}) error {
 		)
 	}
 
+	if len(cached) > 0 {
+		cacheStorage.SetMulti(cached, cache.DefaultTTL)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/olegshs/go-tools/database"
+)
+
+type Config struct {
+	Database string      `json:"database"`
+	Table    string      `json:"table"`
+	Relay    ConfigRelay `json:"relay"`
+}
+
+type ConfigRelay struct {
+	Interval    time.Duration `json:"interval"`     // интервал проверки новых сообщений
+	Batch       int           `json:"batch"`        // максимальное количество сообщений за одну проверку
+	Lease       time.Duration `json:"lease"`        // время, на которое сообщение закрепляется за обработчиком
+	MaxAttempts int           `json:"max_attempts"` // количество попыток доставки, после которого сообщение считается недоставленным
+	Backoff     time.Duration `json:"backoff"`      // задержка перед повторной доставкой, удваивается после каждой попытки
+	MaxBackoff  time.Duration `json:"max_backoff"`  // максимальная задержка
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Database: database.DefaultDB,
+		Table:    "events_outbox",
+		Relay: ConfigRelay{
+			Interval:    time.Second,
+			Batch:       100,
+			Lease:       time.Minute,
+			MaxAttempts: 10,
+			Backoff:     time.Second,
+			MaxBackoff:  time.Hour,
+		},
+	}
+}
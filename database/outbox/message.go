@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/olegshs/go-tools/events"
+)
+
+// Состояния доставки сообщений.
+const (
+	StatusPending   = "pending"   // ожидает доставки
+	StatusDelivered = "delivered" // доставлено
+	StatusFailed    = "failed"    // не доставлено после всех попыток
+)
+
+// Message — событие, сохранённое в таблице outbox.
+// Слушатели события получают *Message единственным аргументом.
+// Доставка выполняется как минимум один раз, поэтому слушатели должны
+// учитывать возможность повторной доставки, например по Id.
+type Message struct {
+	Id        int64
+	Event     events.Event
+	Payload   []byte // данные события в формате JSON
+	Attempts  int    // номер попытки доставки, начиная с 1
+	CreatedAt time.Time
+}
+
+// Decode преобразует данные события в значение v.
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
+}
@@ -0,0 +1,185 @@
+// Пакет outbox реализует шаблон transactional outbox: события записываются в таблицу
+// в той же транзакции, что и изменения данных, и доставляются слушателям после фиксации
+// транзакции, см. Relay. Поддерживаются драйверы sqlite3, mysql и postgres.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/olegshs/go-tools/database"
+	"github.com/olegshs/go-tools/database/interfaces"
+	"github.com/olegshs/go-tools/database/query"
+	"github.com/olegshs/go-tools/events"
+)
+
+var (
+	ErrUnsupportedDriver = errors.New("unsupported database driver")
+)
+
+type Outbox struct {
+	db    string
+	table string
+}
+
+func New(conf Config) *Outbox {
+	o := new(Outbox)
+	o.db = conf.Database
+	o.table = conf.Table
+
+	return o
+}
+
+// CreateTable создаёт таблицу сообщений, если она не существует.
+func (o *Outbox) CreateTable() error {
+	db, err := database.Get(o.db)
+	if err != nil {
+		return err
+	}
+
+	h := db.Helper()
+	table := h.EscapeName(o.table)
+	index := h.EscapeName(o.table + "_status")
+
+	var queries []string
+
+	switch db.Driver() {
+	case database.DriverSqlite3:
+		queries = []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+				"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"event" VARCHAR(255) NOT NULL,
+				"payload" TEXT NOT NULL,
+				"status" VARCHAR(16) NOT NULL,
+				"attempts" INTEGER NOT NULL DEFAULT 0,
+				"last_error" TEXT,
+				"created_at" BIGINT NOT NULL,
+				"available_at" BIGINT NOT NULL,
+				"delivered_at" BIGINT
+			)`,
+			`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + table + ` ("status", "available_at")`,
+		}
+
+	case database.DriverMysql:
+		queries = []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+				id BIGINT NOT NULL AUTO_INCREMENT,
+				event VARCHAR(255) NOT NULL,
+				payload MEDIUMTEXT NOT NULL,
+				status VARCHAR(16) NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				last_error TEXT,
+				created_at BIGINT NOT NULL,
+				available_at BIGINT NOT NULL,
+				delivered_at BIGINT,
+				PRIMARY KEY (id),
+				KEY ` + index + ` (status, available_at)
+			)`,
+		}
+
+	case database.DriverPostgres:
+		queries = []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+				"id" BIGSERIAL PRIMARY KEY,
+				"event" VARCHAR(255) NOT NULL,
+				"payload" TEXT NOT NULL,
+				"status" VARCHAR(16) NOT NULL,
+				"attempts" INTEGER NOT NULL DEFAULT 0,
+				"last_error" TEXT,
+				"created_at" BIGINT NOT NULL,
+				"available_at" BIGINT NOT NULL,
+				"delivered_at" BIGINT
+			)`,
+			`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + table + ` ("status", "available_at")`,
+		}
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedDriver, db.Driver())
+	}
+
+	for _, q := range queries {
+		_, err = db.Exec(q)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add записывает событие в таблицу сообщений. Чтобы событие было доставлено только после
+// фиксации транзакции, в качестве db следует передать *database.Tx.
+// Данные события сохраняются в формате JSON.
+func (o *Outbox) Add(db interfaces.DB, e events.Event, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := timestamp(time.Now())
+
+	_, err = db.Insert(o.table, query.Data{
+		"event":        string(e),
+		"payload":      string(b),
+		"status":       StatusPending,
+		"attempts":     0,
+		"created_at":   now,
+		"available_at": now,
+	}).Exec()
+
+	return err
+}
+
+// Count возвращает количество сообщений в указанном состоянии.
+func (o *Outbox) Count(status string) (int64, error) {
+	var count int64
+
+	db, err := database.Get(o.db)
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.Select(
+		query.Expr("COUNT(*)"),
+	).From(
+		o.table,
+	).Where(
+		query.Eq{
+			"status": status,
+		},
+	).Row().Scan(&count)
+
+	return count, err
+}
+
+// Purge удаляет доставленные сообщения, которые старше указанного времени.
+func (o *Outbox) Purge(olderThan time.Duration) error {
+	db, err := database.Get(o.db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Delete(
+		o.table,
+	).Where(
+		query.Eq{
+			"status": StatusDelivered,
+		},
+		query.Lt{
+			"delivered_at": timestamp(time.Now().Add(-olderThan)),
+		},
+	).Exec()
+
+	return err
+}
+
+// Время хранится в миллисекундах, как и в других таблицах пакетов.
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromTimestamp(ms int64) time.Time {
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
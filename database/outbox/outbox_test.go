@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/olegshs/go-tools/config"
+	"github.com/olegshs/go-tools/database"
+	"github.com/olegshs/go-tools/database/query"
+	"github.com/olegshs/go-tools/events"
+)
+
+type testPayload struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestOutbox(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "test.*.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	config.Set("database", map[string]interface{}{
+		database.DefaultDB: map[string]interface{}{
+			"driver": database.DriverSqlite3,
+			"file":   f.Name(),
+			"params": map[string]interface{}{},
+		},
+	})
+
+	conf := DefaultConfig()
+	conf.Relay.Backoff = 0
+
+	o := New(conf)
+
+	err = o.CreateTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Get(database.DefaultDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Add(tx, "UserCreated", testPayload{1, "rolled back"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Add(tx, "UserCreated", testPayload{2, "committed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Add(tx, "UserDeleted", testPayload{2, "committed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	if n, _ := o.Count(StatusPending); n != 2 {
+		t.Errorf(`Count(StatusPending) = %d, expected 2`, n)
+	}
+
+	d := events.New()
+	relay := NewRelay(o, d, conf.Relay)
+
+	var received []testPayload
+	d.AddListener("UserCreated", func(m *Message) {
+		var p testPayload
+		err := m.Decode(&p)
+		if err != nil {
+			t.Error(err)
+		}
+		received = append(received, p)
+	})
+
+	n, err := relay.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(received) != 1 || received[0].Name != "committed" {
+		t.Errorf(`Run() = %d, received %v`, n, received)
+	}
+
+	// у события UserDeleted нет слушателей, сообщение остаётся в очереди
+	if n, _ := o.Count(StatusPending); n != 1 {
+		t.Errorf(`Count(StatusPending) = %d, expected 1`, n)
+	}
+
+	attempts := 0
+	d.AddListener("UserDeleted", func(m *Message) error {
+		attempts++
+		if m.Attempts != attempts {
+			t.Errorf(`Message.Attempts = %d, expected %d`, m.Attempts, attempts)
+		}
+		return errors.New("temporary failure")
+	})
+
+	for i := 0; i < conf.Relay.MaxAttempts+2; i++ {
+		_, err := relay.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if attempts != conf.Relay.MaxAttempts {
+		t.Errorf(`%d delivery attempts, expected %d`, attempts, conf.Relay.MaxAttempts)
+	}
+	if n, _ := o.Count(StatusFailed); n != 1 {
+		t.Errorf(`Count(StatusFailed) = %d, expected 1`, n)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	err = o.Purge(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := o.Count(StatusDelivered); n != 0 {
+		t.Errorf(`Count(StatusDelivered) = %d after Purge, expected 0`, n)
+	}
+
+	// сообщения без слушателей в начале очереди не задерживают последующие
+	relayConf := conf.Relay
+	relayConf.Batch = 2
+
+	for i := 0; i < relayConf.Batch+1; i++ {
+		err = o.Add(db, "UserUpdated", testPayload{3, "unlistened"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = o.Add(db, "UserCreated", testPayload{4, "after unlistened"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received = nil
+
+	n, err = NewRelay(o, d, relayConf).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(received) != 1 || received[0].Id != 4 {
+		t.Errorf(`Run() = %d, received %v after unlistened messages`, n, received)
+	}
+
+	// слушатель не уложился во время закрепления: сообщение закрепляет и доставляет
+	// другой обработчик, а результат первого не должен изменить его состояние
+	leaseConf := conf.Relay
+	leaseConf.Lease = time.Millisecond
+
+	err = o.Add(db, "UserRenamed", testPayload{5, "slow listener"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	d.AddListener("UserRenamed", func(m *Message) error {
+		calls++
+		if calls > 1 {
+			return nil
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		_, err := NewRelay(o, d, leaseConf).Run(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		return errors.New("lease expired")
+	})
+
+	_, err = NewRelay(o, d, leaseConf).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		status string
+		saved  int
+	)
+	err = db.Select("status", "attempts").From(o.table).Where(
+		query.Eq{"event": "UserRenamed"},
+	).Row().Scan(&status, &saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || status != StatusDelivered || saved != 2 {
+		t.Errorf(`%d calls, status %s, attempts %d; expected 2 calls, status %s, attempts 2`,
+			calls, status, saved, StatusDelivered)
+	}
+
+	db.Close()
+}
@@ -0,0 +1,286 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/olegshs/go-tools/database"
+	"github.com/olegshs/go-tools/database/query"
+	"github.com/olegshs/go-tools/events"
+	"github.com/olegshs/go-tools/helpers"
+	"github.com/olegshs/go-tools/logs"
+)
+
+// Relay доставляет сообщения из таблицы outbox слушателям диспетчера.
+// Перед доставкой сообщение закрепляется за обработчиком на время Lease, поэтому
+// несколько экземпляров Relay могут обрабатывать одну таблицу одновременно.
+// Если слушатель вернул ошибку, то доставка повторяется с увеличивающейся задержкой;
+// после MaxAttempts попыток сообщение получает состояние StatusFailed.
+// Сообщения о событиях, у которых нет слушателей, остаются в очереди.
+type Relay struct {
+	outbox   *Outbox
+	events   *events.Dispatcher
+	conf     ConfigRelay
+	interval *helpers.Interval
+}
+
+func NewRelay(o *Outbox, d *events.Dispatcher, conf ConfigRelay) *Relay {
+	if conf.Batch < 1 {
+		conf.Batch = 1
+	}
+
+	r := new(Relay)
+	r.outbox = o
+	r.events = d
+	r.conf = conf
+
+	return r
+}
+
+// Start запускает периодическую доставку сообщений с интервалом Interval.
+func (r *Relay) Start() {
+	if r.interval != nil {
+		return
+	}
+
+	r.interval = helpers.NewInterval(r.conf.Interval, func() {
+		_, err := r.Run(context.Background())
+		if err != nil {
+			logs.Error("outbox.Relay:", err)
+		}
+	})
+	r.interval.Start()
+}
+
+func (r *Relay) Stop() {
+	if r.interval == nil {
+		return
+	}
+
+	r.interval.Stop()
+	r.interval = nil
+}
+
+// Run выполняет одну проверку: доставляет не более Batch сообщений
+// и возвращает количество успешно доставленных. Сообщения о событиях без слушателей
+// не учитываются в Batch: выборка продолжается после них, поэтому такие сообщения
+// не задерживают доставку последующих.
+func (r *Relay) Run(ctx context.Context) (int, error) {
+	db, err := database.Get(r.outbox.db)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		after     int64
+		processed int
+		delivered int
+	)
+
+	for processed < r.conf.Batch {
+		messages, err := r.fetch(db, after, r.conf.Batch)
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, m := range messages {
+			if processed >= r.conf.Batch {
+				break
+			}
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+
+			after = m.message.Id
+
+			if !r.events.Bus().HasListeners(m.message.Event) {
+				continue
+			}
+			processed++
+
+			lease, ok, err := r.claim(db, m)
+			if err != nil {
+				return delivered, err
+			}
+			if !ok {
+				continue
+			}
+			m.availableAt = lease
+
+			err = r.events.DispatchContext(ctx, m.message.Event, m.message)
+			if err != nil {
+				err = r.fail(db, m, err)
+			} else {
+				err = r.succeed(db, m)
+				delivered++
+			}
+
+			if err != nil {
+				return delivered, err
+			}
+		}
+
+		if len(messages) < r.conf.Batch {
+			break
+		}
+	}
+
+	return delivered, nil
+}
+
+type pendingMessage struct {
+	message     *Message
+	availableAt int64
+}
+
+// fetch выбирает не более limit ожидающих доставки сообщений с номером больше after.
+func (r *Relay) fetch(db *database.DB, after int64, limit int) ([]pendingMessage, error) {
+	rows, err := db.Select(
+		"id",
+		"event",
+		"payload",
+		"attempts",
+		"created_at",
+		"available_at",
+	).From(
+		r.outbox.table,
+	).Where(
+		query.Eq{
+			"status": StatusPending,
+		},
+		query.Lte{
+			"available_at": timestamp(time.Now()),
+		},
+		query.Gt{
+			"id": after,
+		},
+	).Order(
+		"id",
+	).Limit(
+		limit,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var a []pendingMessage
+
+	for rows.Next() {
+		var (
+			m         = new(Message)
+			event     string
+			payload   string
+			createdAt int64
+			p         pendingMessage
+		)
+
+		err := rows.Scan(&m.Id, &event, &payload, &m.Attempts, &createdAt, &p.availableAt)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Event = events.Event(event)
+		m.Payload = []byte(payload)
+		m.Attempts++
+		m.CreatedAt = fromTimestamp(createdAt)
+
+		p.message = m
+		a = append(a, p)
+	}
+
+	return a, rows.Err()
+}
+
+// claim закрепляет сообщение за текущим обработчиком и возвращает время окончания
+// закрепления. Номер попытки сохраняется сразу, поэтому попытки учитываются в MaxAttempts,
+// даже если обработчик завершился аварийно или не успел доставить сообщение за время Lease.
+// Сообщение не закрепляется, если после выборки его уже закрепил другой обработчик.
+func (r *Relay) claim(db *database.DB, m pendingMessage) (int64, bool, error) {
+	lease := timestamp(time.Now().Add(r.conf.Lease))
+
+	res, err := db.Update(
+		r.outbox.table,
+		query.Data{
+			"attempts":     m.message.Attempts,
+			"available_at": lease,
+		},
+	).Where(
+		query.Eq{
+			"id":           m.message.Id,
+			"status":       StatusPending,
+			"available_at": m.availableAt,
+		},
+	).Exec()
+	if err != nil {
+		return 0, false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return lease, affected == 1, nil
+}
+
+// succeed и fail изменяют состояние сообщения, только если оно всё ещё закреплено
+// за текущим обработчиком: после окончания закрепления сообщение может быть
+// закреплено и доставлено другим обработчиком.
+func (r *Relay) succeed(db *database.DB, m pendingMessage) error {
+	_, err := db.Update(
+		r.outbox.table,
+		query.Data{
+			"status":       StatusDelivered,
+			"attempts":     m.message.Attempts,
+			"last_error":   nil,
+			"delivered_at": timestamp(time.Now()),
+		},
+	).Where(
+		query.Eq{
+			"id":           m.message.Id,
+			"status":       StatusPending,
+			"available_at": m.availableAt,
+		},
+	).Exec()
+
+	return err
+}
+
+func (r *Relay) fail(db *database.DB, m pendingMessage, e error) error {
+	status := StatusPending
+	if r.conf.MaxAttempts > 0 && m.message.Attempts >= r.conf.MaxAttempts {
+		status = StatusFailed
+	}
+
+	_, err := db.Update(
+		r.outbox.table,
+		query.Data{
+			"status":       status,
+			"attempts":     m.message.Attempts,
+			"last_error":   e.Error(),
+			"available_at": timestamp(time.Now().Add(r.backoff(m.message.Attempts))),
+		},
+	).Where(
+		query.Eq{
+			"id":           m.message.Id,
+			"status":       StatusPending,
+			"available_at": m.availableAt,
+		},
+	).Exec()
+
+	return err
+}
+
+// backoff возвращает задержку перед следующей попыткой доставки.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.conf.Backoff
+	for i := 1; i < attempts && d > 0; i++ {
+		d *= 2
+		if r.conf.MaxBackoff > 0 && d >= r.conf.MaxBackoff {
+			return r.conf.MaxBackoff
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,219 @@
+// Пакет bridge передаёт события диспетчера другим процессам приложения, например через Redis pub/sub.
+//
+// Мост подписывается на выбранные события, сериализует их аргументы в JSON и отправляет в канал.
+// Остальные процессы получают сообщение и отправляют событие в свой диспетчер под тем же названием.
+// Аргументы восстанавливаются из JSON, поэтому слушатели таких событий должны принимать
+// простые типы: строки, числа, bool, срезы и map; ошибки передаются как текст.
+//
+// Событие, полученное от другого процесса, не отправляется повторно, а сообщения
+// текущего процесса игнорируются, поэтому зацикливания не происходит.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/olegshs/go-tools/events"
+	"github.com/olegshs/go-tools/helpers"
+	"github.com/olegshs/go-tools/logs"
+)
+
+type Bridge struct {
+	node      string
+	events    *events.Dispatcher
+	transport Transport
+	channel   string
+	patterns  []string
+
+	subscriptions []events.Subscription
+	cancel        context.CancelFunc
+	mutex         sync.Mutex
+}
+
+type message struct {
+	Node  string       `json:"node"`
+	Event events.Event `json:"event"`
+	Args  []argument   `json:"args"`
+}
+
+type argument struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Error *string         `json:"error,omitempty"`
+}
+
+type nodeContextKey struct{}
+
+// New создаёт мост между диспетчером d и другими процессами.
+func New(d *events.Dispatcher, t Transport, conf Config) *Bridge {
+	b := new(Bridge)
+	b.node = helpers.RandHex(16)
+	b.events = d
+	b.transport = t
+	b.channel = conf.Channel
+	b.patterns = conf.Events
+
+	return b
+}
+
+// NewRedis создаёт мост, который передаёт события через Redis pub/sub.
+func NewRedis(d *events.Dispatcher, conf Config) *Bridge {
+	return New(d, NewRedisTransport(conf.Redis), conf)
+}
+
+// Node возвращает случайный идентификатор моста, который передаётся вместе с событиями.
+func (b *Bridge) Node() string {
+	return b.node
+}
+
+// Start подписывается на канал и начинает передачу событий.
+func (b *Bridge) Start() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := b.transport.Subscribe(ctx, b.channel, b.receive)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	bus := b.events.Bus()
+	for _, pattern := range b.patterns {
+		s := bus.Subscribe(events.Event(pattern), b.forward)
+		b.subscriptions = append(b.subscriptions, s)
+	}
+
+	b.cancel = cancel
+
+	return nil
+}
+
+// Stop прекращает передачу событий.
+func (b *Bridge) Stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.cancel == nil {
+		return
+	}
+
+	for _, s := range b.subscriptions {
+		s.Unsubscribe()
+	}
+	b.subscriptions = nil
+
+	b.cancel()
+	b.cancel = nil
+}
+
+// IsRemote сообщает, что событие, которое обрабатывает слушатель, получено от другого процесса.
+func IsRemote(ctx context.Context) bool {
+	return NodeFromContext(ctx) != ""
+}
+
+// NodeFromContext возвращает идентификатор моста, от которого получено событие,
+// или пустую строку для событий текущего процесса.
+func NodeFromContext(ctx context.Context) string {
+	node, _ := ctx.Value(nodeContextKey{}).(string)
+	return node
+}
+
+// forward отправляет событие другим процессам. Ошибки отправки записываются в журнал
+// и не передаются отправителю события, чтобы недоступность канала не влияла на процесс.
+func (b *Bridge) forward(ctx context.Context, args []interface{}) error {
+	if IsRemote(ctx) {
+		return nil
+	}
+
+	e := events.EventFromContext(ctx)
+
+	data, err := b.encode(e, args)
+	if err == nil {
+		err = b.transport.Publish(b.channel, data)
+	}
+	if err != nil {
+		logs.Error("bridge.Bridge:", e, err)
+	}
+
+	return nil
+}
+
+func (b *Bridge) receive(data []byte) {
+	m := new(message)
+
+	err := json.Unmarshal(data, m)
+	if err != nil {
+		logs.Error("bridge.Bridge:", err)
+		return
+	}
+
+	if m.Node == b.node {
+		return
+	}
+
+	args, err := decodeArgs(m.Args)
+	if err != nil {
+		logs.Error("bridge.Bridge:", m.Event, err)
+		return
+	}
+
+	ctx := context.WithValue(context.Background(), nodeContextKey{}, m.Node)
+
+	err = b.events.DispatchContext(ctx, m.Event, args...)
+	if err != nil {
+		logs.Error("bridge.Bridge:", m.Event, err)
+	}
+}
+
+func (b *Bridge) encode(e events.Event, args []interface{}) ([]byte, error) {
+	m := message{
+		Node:  b.node,
+		Event: e,
+		Args:  make([]argument, len(args)),
+	}
+
+	for i, v := range args {
+		if err, ok := v.(error); ok {
+			s := err.Error()
+			m.Args[i].Error = &s
+			continue
+		}
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		m.Args[i].Value = raw
+	}
+
+	return json.Marshal(m)
+}
+
+func decodeArgs(a []argument) ([]interface{}, error) {
+	args := make([]interface{}, len(a))
+
+	for i, arg := range a {
+		if arg.Error != nil {
+			args[i] = errors.New(*arg.Error)
+			continue
+		}
+
+		if len(arg.Value) == 0 {
+			continue
+		}
+
+		err := json.Unmarshal(arg.Value, &args[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
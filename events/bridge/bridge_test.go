@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/olegshs/go-tools/events"
+)
+
+type countingTransport struct {
+	*MemoryTransport
+	published int
+}
+
+func (t *countingTransport) Publish(channel string, data []byte) error {
+	t.published++
+	return t.MemoryTransport.Publish(channel, data)
+}
+
+func TestBridge(t *testing.T) {
+	transport := &countingTransport{MemoryTransport: NewMemoryTransport()}
+
+	conf := DefaultConfig()
+	conf.Events = []string{"orm.*"}
+
+	d1 := events.New()
+	d2 := events.New()
+
+	b1 := New(d1, transport, conf)
+	b2 := New(d2, transport, conf)
+
+	for _, b := range []*Bridge{b1, b2} {
+		err := b.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Stop()
+	}
+
+	local := 0
+	d1.AddListener("orm.Invalidate", func(ctx context.Context, table string, id int, err error) {
+		local++
+		if IsRemote(ctx) {
+			t.Error(`local event is marked as remote`)
+		}
+	})
+
+	remote := 0
+	d2.AddListener("orm.Invalidate", func(ctx context.Context, table string, id int, err error) {
+		remote++
+		if NodeFromContext(ctx) != b1.Node() {
+			t.Errorf(`NodeFromContext() = %q, expected %q`, NodeFromContext(ctx), b1.Node())
+		}
+		if table != "posts" || id != 42 || err == nil || err.Error() != "stale" {
+			t.Errorf(`unexpected arguments: %v, %v, %v`, table, id, err)
+		}
+	})
+
+	d1.DispatchSync("orm.Invalidate", "posts", 42, errors.New("stale"))
+
+	if local != 1 || remote != 1 {
+		t.Errorf(`local = %d, remote = %d, expected 1 and 1`, local, remote)
+	}
+	if transport.published != 1 {
+		t.Errorf(`%d messages published, expected 1`, transport.published)
+	}
+
+	d1.DispatchSync("session.Start", "id")
+	if transport.published != 1 {
+		t.Error(`event not matching the configured patterns was forwarded`)
+	}
+
+	b2.Stop()
+	d1.DispatchSync("orm.Invalidate", "posts", 42, nil)
+	if remote != 1 {
+		t.Error(`event was delivered to a stopped bridge`)
+	}
+}
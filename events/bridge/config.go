@@ -0,0 +1,19 @@
+package bridge
+
+import (
+	"github.com/olegshs/go-tools/cache/drivers/redis"
+)
+
+type Config struct {
+	Redis   redis.Config `json:"redis"`   // параметры подключения, как у драйвера кэша redis
+	Channel string       `json:"channel"` // канал Redis, через который передаются события
+	Events  []string     `json:"events"`  // названия или шаблоны событий, которые передаются другим процессам
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Redis:   redis.DefaultConfig(),
+		Channel: "events",
+		Events:  []string{},
+	}
+}
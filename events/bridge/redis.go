@@ -0,0 +1,119 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	redisdriver "github.com/olegshs/go-tools/cache/drivers/redis"
+	"github.com/olegshs/go-tools/logs"
+)
+
+const (
+	redisReconnectDelay = time.Second
+)
+
+// RedisTransport передаёт сообщения через Redis pub/sub.
+// После разрыва соединения подписка восстанавливается автоматически;
+// сообщения, отправленные в это время, теряются.
+type RedisTransport struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+func NewRedisTransport(conf redisdriver.Config) *RedisTransport {
+	t := new(RedisTransport)
+	t.pool = redisdriver.NewPool(conf)
+	t.prefix = conf.Prefix
+
+	return t
+}
+
+func (t *RedisTransport) Publish(channel string, data []byte) error {
+	conn := t.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", t.prefix+channel, data)
+	return err
+}
+
+func (t *RedisTransport) Subscribe(ctx context.Context, channel string, f func(data []byte)) error {
+	psc, err := t.subscribe(channel)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			t.receive(ctx, psc, f)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(redisReconnectDelay):
+				}
+
+				psc, err = t.subscribe(channel)
+				if err == nil {
+					break
+				}
+				logs.Error("bridge.RedisTransport:", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// subscribe открывает соединение и ожидает подтверждения подписки.
+func (t *RedisTransport) subscribe(channel string) (*redis.PubSubConn, error) {
+	psc := &redis.PubSubConn{Conn: t.pool.Get()}
+
+	err := psc.Subscribe(t.prefix + channel)
+	if err != nil {
+		psc.Close()
+		return nil, err
+	}
+
+	switch v := psc.Receive().(type) {
+	case redis.Subscription:
+		return psc, nil
+	case error:
+		psc.Close()
+		return nil, v
+	default:
+		psc.Close()
+		return nil, fmt.Errorf("unexpected reply: %v", v)
+	}
+}
+
+// receive читает сообщения до разрыва соединения или отмены контекста.
+func (t *RedisTransport) receive(ctx context.Context, psc *redis.PubSubConn, f func(data []byte)) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			psc.Close()
+		case <-done:
+		}
+	}()
+
+	defer psc.Close()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			f(v.Data)
+		case error:
+			if ctx.Err() == nil {
+				logs.Error("bridge.RedisTransport:", v)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+)
+
+// Transport передаёт сообщения между процессами.
+type Transport interface {
+	// Publish отправляет сообщение всем подписчикам канала, включая текущий процесс.
+	Publish(channel string, data []byte) error
+
+	// Subscribe подписывается на канал и сразу возвращает управление.
+	// Функция f вызывается для каждого сообщения, пока не отменён контекст.
+	Subscribe(ctx context.Context, channel string, f func(data []byte)) error
+}
+
+// MemoryTransport передаёт сообщения между мостами внутри одного процесса.
+// Сообщения доставляются синхронно, в горутине отправителя. Используется в тестах.
+type MemoryTransport struct {
+	subscribers map[string]map[*memorySubscriber]bool
+	mutex       sync.RWMutex
+}
+
+type memorySubscriber struct {
+	ctx context.Context
+	f   func(data []byte)
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	t := new(MemoryTransport)
+	t.subscribers = map[string]map[*memorySubscriber]bool{}
+
+	return t
+}
+
+func (t *MemoryTransport) Publish(channel string, data []byte) error {
+	t.mutex.RLock()
+	a := make([]*memorySubscriber, 0, len(t.subscribers[channel]))
+	for s := range t.subscribers[channel] {
+		a = append(a, s)
+	}
+	t.mutex.RUnlock()
+
+	for _, s := range a {
+		if s.ctx.Err() == nil {
+			s.f(data)
+		}
+	}
+
+	return nil
+}
+
+func (t *MemoryTransport) Subscribe(ctx context.Context, channel string, f func(data []byte)) error {
+	s := &memorySubscriber{ctx, f}
+
+	t.mutex.Lock()
+	if t.subscribers[channel] == nil {
+		t.subscribers[channel] = map[*memorySubscriber]bool{}
+	}
+	t.subscribers[channel][s] = true
+	t.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		t.mutex.Lock()
+		delete(t.subscribers[channel], s)
+		t.mutex.Unlock()
+	}()
+
+	return nil
+}
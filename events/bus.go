@@ -0,0 +1,364 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrStopPropagation возвращается слушателем, чтобы остальные слушатели события не вызывались.
+	// Эта ошибка не передаётся отправителю события.
+	ErrStopPropagation = errors.New("stop propagation")
+)
+
+// PanicError содержит сведения о панике, которая произошла в слушателе события.
+type PanicError struct {
+	Event Event
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("events: %s: panic: %v", e.Event, e.Value)
+}
+
+// ErrorHandler получает ошибки слушателей, которые не могут быть возвращены отправителю:
+// при параллельном вызове слушателей и при отправке функциями, не возвращающими ошибку.
+type ErrorHandler func(e Event, err error)
+
+// DefaultErrorHandler выводит ошибку в стандартный поток ошибок.
+func DefaultErrorHandler(e Event, err error) {
+	fmt.Fprintln(os.Stderr, "events:", e+":", err)
+
+	var p *PanicError
+	if errors.As(err, &p) {
+		os.Stderr.Write(p.Stack)
+	}
+}
+
+// Bus хранит подписки на события и вызывает слушателей в порядке приоритета.
+// Типизированный доступ к событиям предоставляет Topic.
+//
+// Названия событий могут быть иерархическими, с сегментами через точку, например "database.default.Query".
+// Подписка возможна на шаблон названия, см. IsPattern. Шина, созданная функцией Namespace,
+// дополнительно отправляет свои события в родительскую шину под именами вида "<namespace>.<event>".
+type Bus struct {
+	listeners    map[Event][]*listener
+	patterns     map[Event][]string
+	mutex        sync.RWMutex
+	lastId       uint64
+	errorHandler ErrorHandler
+
+	parent    *Bus
+	namespace Event
+}
+
+// handler получает аргументы события в том виде, в котором они были переданы при отправке.
+type handler func(ctx context.Context, args []interface{}) error
+
+type listener struct {
+	id       uint64
+	priority int
+	handler  handler
+}
+
+// Слушатель вместе с полным названием события, которое ему передаётся.
+// Для слушателей родительских шин inherited = true.
+type target struct {
+	listener  *listener
+	event     Event
+	inherited bool
+}
+
+type eventContextKey struct{}
+
+// EventFromContext возвращает полное название события, которое обрабатывает слушатель.
+// Это полезно для слушателей, подписанных на шаблоны.
+func EventFromContext(ctx context.Context) Event {
+	e, _ := ctx.Value(eventContextKey{}).(Event)
+	return e
+}
+
+// SubscribeOption задаёт параметры подписки.
+type SubscribeOption func(l *listener)
+
+// WithPriority задаёт приоритет слушателя. Слушатели с большим приоритетом вызываются раньше,
+// слушатели с одинаковым приоритетом — в порядке подписки. По умолчанию приоритет равен 0.
+func WithPriority(priority int) SubscribeOption {
+	return func(l *listener) {
+		l.priority = priority
+	}
+}
+
+// Subscription позволяет отменить подписку на событие.
+type Subscription struct {
+	bus   *Bus
+	event Event
+	id    uint64
+}
+
+// NewBus создаёт шину событий.
+func NewBus() *Bus {
+	b := new(Bus)
+	b.listeners = map[Event][]*listener{}
+	b.patterns = map[Event][]string{}
+	b.errorHandler = DefaultErrorHandler
+
+	return b
+}
+
+// Namespace создаёт шину, события которой после вызова её собственных слушателей
+// передаются слушателям этой шины под именами вида "<namespace>.<event>".
+// Слушатели обеих шин вызываются в общем порядке приоритета.
+func (b *Bus) Namespace(namespace string) *Bus {
+	c := NewBus()
+	c.parent = b
+	c.namespace = Event(namespace)
+
+	return c
+}
+
+// SetErrorHandler устанавливает обработчик ошибок слушателей, см. ErrorHandler.
+func (b *Bus) SetErrorHandler(f ErrorHandler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.errorHandler = f
+}
+
+// Unsubscribe отменяет подписку. Повторный вызов ничего не делает.
+func (s Subscription) Unsubscribe() {
+	if s.bus == nil {
+		return
+	}
+
+	s.bus.unsubscribe(s.event, s.id)
+}
+
+// HasListeners сообщает, есть ли подписки на событие, с учётом шаблонов и родительской шины.
+func (b *Bus) HasListeners(e Event) bool {
+	return len(b.targets(e)) > 0
+}
+
+// Subscribe добавляет слушателя, который получает аргументы события без преобразования типов.
+// Это полезно для слушателей, которые передают события дальше, не зная их аргументов.
+func (b *Bus) Subscribe(e Event, f func(ctx context.Context, args []interface{}) error, options ...SubscribeOption) Subscription {
+	return b.subscribe(e, f, options)
+}
+
+func (b *Bus) subscribe(e Event, h handler, options []SubscribeOption) Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.lastId++
+
+	l := &listener{
+		id:      b.lastId,
+		handler: h,
+	}
+	for _, option := range options {
+		option(l)
+	}
+
+	a := append(b.listeners[e], l)
+	sort.SliceStable(a, func(i, j int) bool {
+		return a[i].priority > a[j].priority
+	})
+	b.listeners[e] = a
+
+	if IsPattern(e) {
+		b.patterns[e] = splitEvent(e)
+	}
+
+	return Subscription{b, e, l.id}
+}
+
+func (b *Bus) unsubscribe(e Event, id uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	a := make([]*listener, 0, len(b.listeners[e]))
+	for _, l := range b.listeners[e] {
+		if l.id != id {
+			a = append(a, l)
+		}
+	}
+
+	if len(a) == 0 {
+		delete(b.listeners, e)
+		delete(b.patterns, e)
+		return
+	}
+
+	b.listeners[e] = a
+}
+
+// publish вызывает слушателей события по очереди и возвращает количество вызванных слушателей.
+// Вызовы прекращаются при первой ошибке, при ErrStopPropagation и при отмене контекста.
+func (b *Bus) publish(ctx context.Context, e Event, args []interface{}) (int, error) {
+	a := b.targets(e)
+
+	for i, t := range a {
+		err := ctx.Err()
+		if err != nil {
+			return i, err
+		}
+
+		err = b.call(ctx, t, args)
+		if errors.Is(err, ErrStopPropagation) {
+			return i + 1, nil
+		}
+		if err != nil {
+			return i + 1, err
+		}
+	}
+
+	return len(a), nil
+}
+
+// publishCancelable вызывает слушателей события по очереди, как publish, но прекращает вызовы
+// только при ошибке или ErrStopPropagation собственного слушателя шины. Ошибки слушателей
+// родительских шин передаются обработчику ошибок и не влияют на результат.
+func (b *Bus) publishCancelable(ctx context.Context, e Event, args []interface{}) (int, error) {
+	a := b.targets(e)
+
+	for i, t := range a {
+		err := ctx.Err()
+		if err != nil {
+			return i, err
+		}
+
+		err = b.call(ctx, t, args)
+		if t.inherited {
+			if err != nil && !errors.Is(err, ErrStopPropagation) {
+				b.report(e, err)
+			}
+			continue
+		}
+		if errors.Is(err, ErrStopPropagation) {
+			return i + 1, nil
+		}
+		if err != nil {
+			return i + 1, err
+		}
+	}
+
+	return len(a), nil
+}
+
+// publishAsync вызывает каждого слушателя в отдельной горутине.
+// Возвращаемый канал получает количество слушателей после завершения всех вызовов.
+// Ошибки слушателей передаются обработчику ошибок.
+func (b *Bus) publishAsync(ctx context.Context, e Event, args []interface{}) chan int {
+	a := b.targets(e)
+	n := len(a)
+
+	done := make(chan int, 1)
+	if n == 0 {
+		done <- 0
+		return done
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(n)
+
+	for _, t := range a {
+		go func(t target) {
+			defer wg.Done()
+
+			err := ctx.Err()
+			if err == nil {
+				err = b.call(ctx, t, args)
+			}
+			if err != nil && !errors.Is(err, ErrStopPropagation) {
+				b.report(e, err)
+			}
+		}(t)
+	}
+
+	go func() {
+		wg.Wait()
+		done <- n
+	}()
+
+	return done
+}
+
+// call вызывает слушателя, превращая панику в ошибку PanicError.
+func (b *Bus) call(ctx context.Context, t target, args []interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{t.event, r, debug.Stack()}
+		}
+	}()
+
+	ctx = context.WithValue(ctx, eventContextKey{}, t.event)
+	return t.listener.handler(ctx, args)
+}
+
+func (b *Bus) report(e Event, err error) {
+	b.mutex.RLock()
+	f := b.errorHandler
+	b.mutex.RUnlock()
+
+	if f != nil {
+		f(e, err)
+	}
+}
+
+// targets возвращает слушателей события, включая подписки на шаблоны и слушателей родительских шин,
+// в порядке вызова.
+func (b *Bus) targets(e Event) []target {
+	b.mutex.RLock()
+
+	a := make([]target, 0, len(b.listeners[e]))
+	for _, l := range b.listeners[e] {
+		a = append(a, target{l, e, false})
+	}
+
+	matched := false
+	if len(b.patterns) > 0 {
+		segments := splitEvent(e)
+		for pattern, p := range b.patterns {
+			if pattern == e || !matchEvent(p, segments) {
+				continue
+			}
+			for _, l := range b.listeners[pattern] {
+				a = append(a, target{l, e, false})
+			}
+			matched = true
+		}
+	}
+
+	parent, namespace := b.parent, b.namespace
+	b.mutex.RUnlock()
+
+	if matched {
+		sort.Slice(a, func(i, j int) bool {
+			if a[i].listener.priority != a[j].listener.priority {
+				return a[i].listener.priority > a[j].listener.priority
+			}
+			return a[i].listener.id < a[j].listener.id
+		})
+	}
+
+	if parent != nil {
+		inherited := parent.targets(namespace + "." + e)
+		for i := range inherited {
+			inherited[i].inherited = true
+		}
+		if len(inherited) > 0 {
+			a = append(a, inherited...)
+			sort.SliceStable(a, func(i, j int) bool {
+				return a[i].listener.priority > a[j].listener.priority
+			})
+		}
+	}
+
+	return a
+}
@@ -1,7 +1,13 @@
 // Пакет events реализует диспетчер событий.
+//
+// Основу пакета составляет шина событий Bus с типизированными событиями Topic.
+// Dispatcher сохранён для совместимости: он работает поверх шины
+// и вызывает слушателей с произвольными аргументами через reflect.
 package events
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"sync"
 
@@ -12,26 +18,61 @@ type Event string
 
 type Callback interface{}
 
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
 type Dispatcher struct {
-	events map[Event][]reflect.Value
-	mutex  sync.RWMutex
+	bus   *Bus
+	refs  map[Event][]callbackRef
+	queue *Queue
+	mutex sync.Mutex
+}
+
+// Подписка слушателя, добавленного функцией AddListener.
+type callbackRef struct {
+	f   reflect.Value
+	sub Subscription
 }
 
 func New() *Dispatcher {
+	return NewWithBus(NewBus())
+}
+
+// NewWithBus создаёт диспетчер, который работает с указанной шиной событий.
+func NewWithBus(bus *Bus) *Dispatcher {
 	d := Dispatcher{
-		map[Event][]reflect.Value{},
-		sync.RWMutex{},
+		bus:  bus,
+		refs: map[Event][]callbackRef{},
 	}
 	return &d
 }
 
-func (d *Dispatcher) AddListener(e Event, f Callback) {
+// Namespace создаёт диспетчер, события которого дополнительно передаются слушателям d
+// под именами вида "<namespace>.<event>", см. Bus.Namespace.
+func (d *Dispatcher) Namespace(namespace string) *Dispatcher {
+	return NewWithBus(d.bus.Namespace(namespace))
+}
+
+// Bus возвращает шину событий диспетчера, например для создания Topic.
+func (d *Dispatcher) Bus() *Bus {
+	return d.bus
+}
+
+// AddListener добавляет слушателя события. Аргументы события преобразуются
+// к типам аргументов функции f. Если первый аргумент f имеет тип context.Context,
+// то в него передаётся контекст отправки. Если последнее возвращаемое значение f
+// имеет тип error, то ошибка прекращает вызов остальных слушателей, см. DispatchContext.
+func (d *Dispatcher) AddListener(e Event, f Callback, options ...SubscribeOption) {
 	rv := d.value(f)
 
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	d.events[e] = append(d.events[e], rv)
+	sub := d.bus.subscribe(e, callbackHandler(e, rv), options)
+
+	d.refs[e] = append(d.refs[e], callbackRef{rv, sub})
 }
 
 func (d *Dispatcher) RemoveListener(e Event, f Callback) {
@@ -40,74 +81,113 @@ func (d *Dispatcher) RemoveListener(e Event, f Callback) {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	a := make([]reflect.Value, 0, len(d.events[e]))
-	for _, f := range d.events[e] {
-		if f != rv {
-			a = append(a, f)
+	a := make([]callbackRef, 0, len(d.refs[e]))
+	for _, ref := range d.refs[e] {
+		if ref.f != rv {
+			a = append(a, ref)
+			continue
 		}
+
+		ref.sub.Unsubscribe()
 	}
 
 	if len(a) == 0 {
-		delete(d.events, e)
+		delete(d.refs, e)
 		return
 	}
 
-	d.events[e] = a
+	d.refs[e] = a
+}
+
+// SetQueue включает доставку событий, отправляемых функцией Dispatch, через очередь.
+// Очередь должна быть создана для шины этого диспетчера. Если q == nil, то очередь отключается.
+func (d *Dispatcher) SetQueue(q *Queue) {
+	if q != nil && q.bus != d.bus {
+		panic("events: queue belongs to another bus")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.queue = q
 }
 
+// Queue возвращает очередь, установленную функцией SetQueue.
+func (d *Dispatcher) Queue() *Queue {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.queue
+}
+
+// Dispatch вызывает слушателей события параллельно, либо ставит событие в очередь, см. SetQueue.
+// Возвращаемый канал получает количество слушателей после завершения всех вызовов;
+// если событие не попало в очередь, то канал получает 0.
+// Ошибки слушателей передаются обработчику ошибок шины, см. Bus.SetErrorHandler.
 func (d *Dispatcher) Dispatch(e Event, args ...interface{}) chan int {
-	a := d.listeners(e)
-	n := len(a)
-
-	c := make(chan int, n)
-	for i, f := range a {
-		go func(i int, f reflect.Value) {
-			_, err := call.Func(f, args...)
-			if err != nil {
-				panic(err)
-			}
-
-			c <- i
-		}(i, f)
+	q := d.Queue()
+	if q == nil {
+		return d.bus.publishAsync(context.Background(), e, args)
 	}
 
-	done := make(chan int)
-	go func() {
-		for i := 0; i < n; i++ {
-			<-c
-		}
-		done <- n
-	}()
+	// отброшенные при переполнении события учитываются в Queue.Dropped
+	done, err := q.publish(context.Background(), e, args)
+	if err != nil && err != ErrQueueFull {
+		d.bus.report(e, err)
+	}
 
 	return done
 }
 
+// DispatchSync вызывает слушателей события по очереди и возвращает количество вызванных слушателей.
+// Ошибка слушателя передаётся обработчику ошибок шины.
 func (d *Dispatcher) DispatchSync(e Event, args ...interface{}) int {
-	a := d.listeners(e)
-	n := len(a)
-
-	for _, f := range a {
-		_, err := call.Func(f, args...)
-		if err != nil {
-			panic(err)
-		}
+	n, err := d.bus.publish(context.Background(), e, args)
+	if err != nil {
+		d.bus.report(e, err)
 	}
 
 	return n
 }
 
-func (d *Dispatcher) listeners(e Event) []reflect.Value {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+// DispatchContext вызывает слушателей события по очереди и возвращает первую ошибку.
+// Паника в слушателе возвращается как PanicError. Вызовы прекращаются, если контекст отменён.
+func (d *Dispatcher) DispatchContext(ctx context.Context, e Event, args ...interface{}) error {
+	_, err := d.bus.publish(ctx, e, args)
+	return err
+}
 
-	n := len(d.events[e])
-	a := make([]reflect.Value, n)
+// DispatchCancelable вызывает слушателей события по очереди и возвращает первую ошибку
+// слушателя, добавленного в этот диспетчер; такая ошибка отменяет действие, о котором сообщает событие.
+// Слушатели родительского диспетчера, см. Namespace, также вызываются, но их ошибки
+// передаются обработчику ошибок шины и не отменяют действие: например, слушатель
+// всех событий "**" в events.Shared не может помешать работе пакета, который отправляет события.
+func (d *Dispatcher) DispatchCancelable(ctx context.Context, e Event, args ...interface{}) error {
+	_, err := d.bus.publishCancelable(ctx, e, args)
+	return err
+}
 
-	for i, f := range d.events[e] {
-		a[i] = f
-	}
+// callbackHandler вызывает функцию слушателя через reflect.
+func callbackHandler(e Event, f reflect.Value) handler {
+	t := f.Type()
+	withContext := t.NumIn() > 0 && t.In(0) == contextType
+	withError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
 
-	return a
+	return func(ctx context.Context, args []interface{}) error {
+		if withContext {
+			args = append([]interface{}{ctx}, args...)
+		}
+
+		out, err := call.Func(f, args...)
+		if err != nil {
+			return fmt.Errorf("events: %s: %w", e, err)
+		}
+
+		if withError {
+			err, _ = out[len(out)-1].(error)
+		}
+		return err
+	}
 }
 
 func (d *Dispatcher) value(f Callback) reflect.Value {
@@ -0,0 +1,432 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	Id   string
+	Data []byte
+}
+
+func TestTopic(t *testing.T) {
+	bus := NewBus()
+	topic := NewTopic[testPayload](bus, "Save")
+
+	var calls []string
+
+	topic.Subscribe(func(p testPayload) {
+		calls = append(calls, "default:"+p.Id)
+	})
+	sub := topic.Subscribe(func(p testPayload) {
+		calls = append(calls, "high:"+p.Id)
+	}, WithPriority(10))
+	topic.Subscribe(func(p testPayload) {
+		calls = append(calls, "low:"+p.Id)
+	}, WithPriority(-1))
+
+	if n := topic.Publish(testPayload{Id: "a"}); n != 3 {
+		t.Errorf(`Publish: %d != 3`, n)
+	}
+
+	expected := "[high:a default:a low:a]"
+	if s := fmt.Sprint(calls); s != expected {
+		t.Errorf(`%s != %s`, s, expected)
+	}
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	if n := topic.Publish(testPayload{Id: "b"}); n != 2 {
+		t.Errorf(`Publish: %d != 2`, n)
+	}
+
+	async := NewTopic[int](bus, "Async")
+
+	var sum int32
+	for i := 0; i < 3; i++ {
+		async.Subscribe(func(n int) {
+			atomic.AddInt32(&sum, int32(n))
+		})
+	}
+
+	if n := <-async.PublishAsync(2); n != 3 || atomic.LoadInt32(&sum) != 6 {
+		t.Errorf(`PublishAsync: %d, sum: %d`, n, sum)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	d := New()
+	topic := NewTopic[*testPayload](d.Bus(), "Load")
+
+	var typed, untyped int
+
+	topic.Subscribe(func(p *testPayload) {
+		typed++
+	})
+
+	f := func(p *testPayload) {
+		untyped++
+	}
+	d.AddListener("Load", f)
+
+	if n := d.DispatchSync("Load", &testPayload{}); n != 2 {
+		t.Errorf(`DispatchSync: %d != 2`, n)
+	}
+
+	// слушатель Topic пропускает события с другим набором аргументов
+	d.DispatchSync("Load", &testPayload{}, 1)
+
+	if typed != 1 || untyped != 2 {
+		t.Errorf(`typed: %d, untyped: %d`, typed, untyped)
+	}
+
+	d.RemoveListener("Load", f)
+
+	if n := <-d.Dispatch("Load", nil); n != 1 || typed != 2 {
+		t.Errorf(`Dispatch: %d, typed: %d`, n, typed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	d := New()
+
+	var reported []error
+	d.Bus().SetErrorHandler(func(e Event, err error) {
+		reported = append(reported, err)
+	})
+
+	errVeto := errors.New("veto")
+	calls := 0
+
+	d.AddListener("Save", func(ctx context.Context, id string) error {
+		calls++
+		if id == "veto" {
+			return errVeto
+		}
+		if id == "stop" {
+			return ErrStopPropagation
+		}
+		return nil
+	}, WithPriority(1))
+	d.AddListener("Save", func(id string) {
+		calls++
+		if id == "panic" {
+			panic("oops")
+		}
+	})
+
+	if err := d.DispatchContext(context.Background(), "Save", "veto"); err != errVeto || calls != 1 {
+		t.Errorf(`veto: %v, calls: %d`, err, calls)
+	}
+
+	calls = 0
+	if err := d.DispatchContext(context.Background(), "Save", "stop"); err != nil || calls != 1 {
+		t.Errorf(`stop: %v, calls: %d`, err, calls)
+	}
+
+	var p *PanicError
+	if err := d.DispatchContext(context.Background(), "Save", "panic"); !errors.As(err, &p) || p.Value != "oops" {
+		t.Errorf(`panic: %v`, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls = 0
+	if err := d.DispatchContext(ctx, "Save", "ok"); err != context.Canceled || calls != 0 {
+		t.Errorf(`canceled: %v, calls: %d`, err, calls)
+	}
+
+	d.AddListener("Async", func() {
+		panic("async")
+	})
+
+	<-d.Dispatch("Async")
+	d.DispatchSync("Save", "veto")
+
+	if len(reported) != 2 || !errors.As(reported[0], &p) || reported[1] != errVeto {
+		t.Errorf(`reported: %v`, reported)
+	}
+
+	topic := NewTopic[int](d.Bus(), "Count")
+	topic.SubscribeContext(func(ctx context.Context, n int) error {
+		if n < 0 {
+			return errVeto
+		}
+		return nil
+	})
+
+	if err := topic.PublishContext(context.Background(), -1); err != errVeto {
+		t.Errorf(`topic: %v`, err)
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	shared := New()
+	db := shared.Namespace("database.default")
+	sess := shared.Namespace("session")
+
+	var received []Event
+	observe := func(ctx context.Context) {
+		received = append(received, EventFromContext(ctx))
+	}
+
+	shared.AddListener("database.*.Query", observe)
+	shared.AddListener("session.**", observe, WithPriority(1))
+	sub := shared.Bus().subscribe("**.Before*", func(ctx context.Context, args []interface{}) error {
+		received = append(received, "before:"+EventFromContext(ctx))
+		return nil
+	}, nil)
+
+	local := 0
+	sess.AddListener("BeforeSave", func() {
+		local++
+	})
+
+	db.DispatchSync("Query")
+	db.DispatchSync("Exec")
+	sess.DispatchSync("BeforeSave")
+	shared.DispatchSync("session.storage.AfterLoad")
+
+	expected := "[database.default.Query session.BeforeSave before:session.BeforeSave session.storage.AfterLoad]"
+	if s := fmt.Sprint(received); s != expected || local != 1 {
+		t.Errorf(`%s != %s, local: %d`, s, expected, local)
+	}
+
+	sub.Unsubscribe()
+
+	if !db.Bus().HasListeners("Query") || db.Bus().HasListeners("Exec") {
+		t.Error(`HasListeners`)
+	}
+
+	for pattern, names := range map[Event][]Event{
+		"a.*":    {"a.b"},
+		"a.**":   {"a", "a.b", "a.b.c"},
+		"a.**.c": {"a.c", "a.b.c", "a.b.b.c"},
+		"*.b":    {"a.b", "c.b"},
+	} {
+		for _, name := range names {
+			if !matchEvent(splitEvent(pattern), splitEvent(name)) {
+				t.Errorf(`%s does not match %s`, pattern, name)
+			}
+		}
+	}
+
+	for pattern, name := range map[Event]Event{
+		"a.*":    "a.b.c",
+		"a.**.c": "a.b.d",
+		"*.b":    "b",
+	} {
+		if matchEvent(splitEvent(pattern), splitEvent(name)) {
+			t.Errorf(`%s matches %s`, pattern, name)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	d := New()
+
+	conf := DefaultQueueConfig()
+	conf.Workers = 2
+	conf.Backoff = time.Millisecond
+
+	q := NewQueue(d.Bus(), conf)
+	d.SetQueue(q)
+
+	var delivered, attempts int32
+	tries := make([]int32, 10)
+	d.AddListener("Job", func(i int) error {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.AddInt32(&tries[i], 1) < 3 {
+			return errors.New("temporary error")
+		}
+		atomic.AddInt32(&delivered, 1)
+		return nil
+	})
+
+	for i := 0; i < 10; i++ {
+		d.Dispatch("Job", i)
+	}
+
+	err := q.Drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != 10 || attempts != 30 || q.Pending() != 0 || q.Failed() != 0 {
+		t.Errorf(`delivered: %d, attempts: %d, pending: %d, failed: %d`, delivered, attempts, q.Pending(), q.Failed())
+	}
+
+	if err := q.Publish(context.Background(), "Job", 1); err != ErrQueueClosed {
+		t.Errorf(`closed: %v`, err)
+	}
+}
+
+func TestQueue_Policies(t *testing.T) {
+	for _, policy := range []string{PolicyDrop, PolicyDropOldest} {
+		bus := NewBus()
+		bus.SetErrorHandler(func(e Event, err error) {})
+
+		release := make(chan struct{})
+		var received []int
+		NewTopic[int](bus, "Job").Subscribe(func(n int) {
+			<-release
+			received = append(received, n)
+		})
+
+		conf := DefaultQueueConfig()
+		conf.Buffer = 2
+		conf.Workers = 1
+		conf.Policy = policy
+
+		q := NewQueue(bus, conf)
+
+		// первое событие занимает обработчик, следующие два заполняют очередь
+		q.Publish(context.Background(), "Job", 1)
+		for len(q.items) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		q.Publish(context.Background(), "Job", 2)
+		q.Publish(context.Background(), "Job", 3)
+
+		err := q.Publish(context.Background(), "Job", 4)
+		close(release)
+
+		q.Drain(context.Background())
+
+		expected := "[1 2 3]"
+		if policy == PolicyDropOldest {
+			expected = "[1 3 4]"
+		} else if err != ErrQueueFull {
+			t.Errorf(`%s: %v`, policy, err)
+		}
+
+		if s := fmt.Sprint(received); s != expected || q.Dropped() != 1 {
+			t.Errorf(`%s: %s != %s, dropped: %d`, policy, s, expected, q.Dropped())
+		}
+	}
+}
+
+func TestQueue_DrainTimeout(t *testing.T) {
+	bus := NewBus()
+	bus.SetErrorHandler(func(e Event, err error) {})
+
+	NewTopic[int](bus, "Job").SubscribeContext(func(ctx context.Context, n int) error {
+		return errors.New("permanent error")
+	})
+
+	conf := DefaultQueueConfig()
+	conf.Backoff = time.Hour
+
+	q := NewQueue(bus, conf)
+	q.Publish(context.Background(), "Job", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := q.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf(`Drain: %v`, err)
+	}
+
+	for q.Pending() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if q.Failed() != 1 {
+		t.Errorf(`failed: %d`, q.Failed())
+	}
+}
+
+func TestQueue_DrainBlocked(t *testing.T) {
+	bus := NewBus()
+
+	release := make(chan struct{})
+	NewTopic[int](bus, "Job").Subscribe(func(n int) {
+		<-release
+	})
+
+	conf := DefaultQueueConfig()
+	conf.Buffer = 1
+	conf.Workers = 1
+	conf.Policy = PolicyBlock
+
+	q := NewQueue(bus, conf)
+
+	// первое событие занимает обработчик, второе заполняет очередь, третье ожидает места
+	q.Publish(context.Background(), "Job", 1)
+	for len(q.items) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Publish(context.Background(), "Job", 2)
+
+	published := make(chan error)
+	go func() {
+		published <- q.Publish(context.Background(), "Job", 3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := q.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf(`Drain: %v`, err)
+	}
+
+	select {
+	case err := <-published:
+		if err != ErrQueueClosed {
+			t.Errorf(`blocked Publish: %v`, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`blocked Publish is not interrupted by Drain`)
+	}
+
+	close(release)
+
+	if err := q.Drain(context.Background()); err != nil {
+		t.Errorf(`Drain: %v`, err)
+	}
+	if q.Pending() != 0 {
+		t.Errorf(`pending: %d`, q.Pending())
+	}
+}
+
+func TestDispatchCancelable(t *testing.T) {
+	shared := New()
+	sess := shared.Namespace("session")
+
+	var reported []Event
+	shared.Bus().SetErrorHandler(func(e Event, err error) {
+		reported = append(reported, e)
+	})
+	sess.Bus().SetErrorHandler(func(e Event, err error) {
+		reported = append(reported, e)
+	})
+
+	shared.AddListener("**", func() error {
+		return errors.New("observer failure")
+	}, WithPriority(1))
+	shared.AddListener("session.BeforeSave", func(id string, data []byte) {})
+
+	if err := sess.DispatchCancelable(context.Background(), "BeforeSave", "id"); err != nil {
+		t.Errorf(`DispatchCancelable() = %v, inherited listeners cancelled the action`, err)
+	}
+	if len(reported) != 2 {
+		t.Errorf(`%d errors reported, expected 2`, len(reported))
+	}
+
+	errVeto := errors.New("veto")
+	sess.AddListener("BeforeSave", func() error {
+		return errVeto
+	})
+
+	if err := sess.DispatchCancelable(context.Background(), "BeforeSave"); err != errVeto {
+		t.Errorf(`DispatchCancelable() = %v, expected veto of own listener`, err)
+	}
+}
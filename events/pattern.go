@@ -0,0 +1,50 @@
+package events
+
+import (
+	"path"
+	"strings"
+)
+
+// IsPattern сообщает, является ли название события шаблоном.
+//
+// Шаблон состоит из сегментов, разделённых точками. Сегмент "*" соответствует одному
+// любому сегменту названия, сегмент "**" — любому количеству сегментов, в том числе ни одному.
+// Остальные сегменты сравниваются по правилам path.Match, например "Before*".
+// Так, шаблону "database.*.Query" соответствует событие "database.default.Query",
+// а шаблону "session.**" — все события с префиксом "session.".
+func IsPattern(e Event) bool {
+	return strings.ContainsAny(string(e), "*?[")
+}
+
+func splitEvent(e Event) []string {
+	return strings.Split(string(e), ".")
+}
+
+func matchEvent(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(segments); i++ {
+				if matchEvent(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
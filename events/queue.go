@@ -0,0 +1,294 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Политики переполнения очереди.
+const (
+	PolicyBlock      = "block"       // ждать освобождения места в очереди
+	PolicyDrop       = "drop"        // отбросить новое событие
+	PolicyDropOldest = "drop_oldest" // отбросить самое старое событие в очереди
+)
+
+var (
+	ErrQueueFull   = errors.New("event queue is full")
+	ErrQueueClosed = errors.New("event queue is closed")
+)
+
+type QueueConfig struct {
+	Buffer     int           `json:"buffer"`      // размер очереди
+	Workers    int           `json:"workers"`     // количество обработчиков
+	Policy     string        `json:"policy"`      // политика переполнения, например PolicyBlock
+	Retries    int           `json:"retries"`     // количество повторных вызовов слушателя после ошибки
+	Backoff    time.Duration `json:"backoff"`     // задержка перед первым повторным вызовом, далее удваивается
+	MaxBackoff time.Duration `json:"max_backoff"` // максимальная задержка
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Buffer:     1024,
+		Workers:    4,
+		Policy:     PolicyBlock,
+		Retries:    3,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+// Queue доставляет события слушателям шины через очередь ограниченного размера,
+// которую обрабатывает фиксированное количество горутин. Слушатели одного события
+// вызываются по очереди в порядке приоритета; после ошибки вызов слушателя повторяется
+// с увеличивающейся задержкой. Ошибки, оставшиеся после повторов, передаются обработчику ошибок шины.
+type Queue struct {
+	bus   *Bus
+	conf  QueueConfig
+	items chan *queueItem
+
+	// mutex защищает closed и senders: отправитель регистрируется в senders под блокировкой
+	// на чтение, а сама отправка выполняется без блокировки и прерывается закрытием closing.
+	// Канал items закрывается только после завершения всех отправок.
+	mutex   sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	senders sync.WaitGroup
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+
+	pending int64
+	dropped int64
+	failed  int64
+}
+
+type queueItem struct {
+	ctx   context.Context
+	event Event
+	args  []interface{}
+	done  chan int
+}
+
+// NewQueue создаёт очередь событий шины и запускает обработчики.
+func NewQueue(bus *Bus, conf QueueConfig) *Queue {
+	if conf.Buffer < 1 {
+		conf.Buffer = 1
+	}
+	if conf.Workers < 1 {
+		conf.Workers = 1
+	}
+
+	switch conf.Policy {
+	case PolicyBlock, PolicyDrop, PolicyDropOldest:
+	case "":
+		conf.Policy = PolicyBlock
+	default:
+		panic("invalid queue policy: " + conf.Policy)
+	}
+
+	q := new(Queue)
+	q.bus = bus
+	q.conf = conf
+	q.items = make(chan *queueItem, conf.Buffer)
+	q.closing = make(chan struct{})
+	q.stop = make(chan struct{})
+
+	q.workers.Add(conf.Workers)
+	for i := 0; i < conf.Workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Publish ставит событие в очередь. При политике PolicyBlock ожидание места
+// в очереди прерывается отменой контекста. Контекст также передаётся слушателям,
+// поэтому для событий, которые должны быть доставлены после завершения запроса,
+// следует использовать context.Background().
+func (q *Queue) Publish(ctx context.Context, e Event, args ...interface{}) error {
+	_, err := q.publish(ctx, e, args)
+	return err
+}
+
+func (q *Queue) publish(ctx context.Context, e Event, args []interface{}) (chan int, error) {
+	item := &queueItem{ctx, e, args, make(chan int, 1)}
+
+	q.mutex.RLock()
+	if q.closed {
+		q.mutex.RUnlock()
+		item.done <- 0
+		return item.done, ErrQueueClosed
+	}
+	q.senders.Add(1)
+	q.mutex.RUnlock()
+
+	defer q.senders.Done()
+
+	atomic.AddInt64(&q.pending, 1)
+
+	switch q.conf.Policy {
+	case PolicyDrop:
+		select {
+		case q.items <- item:
+		default:
+			q.discard(item)
+			return item.done, ErrQueueFull
+		}
+
+	case PolicyDropOldest:
+		for {
+			select {
+			case q.items <- item:
+				return item.done, nil
+			default:
+			}
+
+			select {
+			case old := <-q.items:
+				q.discard(old)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case q.items <- item:
+		case <-ctx.Done():
+			atomic.AddInt64(&q.pending, -1)
+			item.done <- 0
+			return item.done, ctx.Err()
+		case <-q.closing:
+			atomic.AddInt64(&q.pending, -1)
+			item.done <- 0
+			return item.done, ErrQueueClosed
+		}
+	}
+
+	return item.done, nil
+}
+
+// Drain прекращает приём событий и ожидает обработки событий, оставшихся в очереди.
+// Публикации, ожидающие места в очереди, завершаются с ошибкой ErrQueueClosed.
+// Если контекст отменён раньше, то повторные вызовы слушателей прекращаются,
+// а функция возвращает ошибку контекста.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+
+		go func() {
+			q.senders.Wait()
+			close(q.items)
+		}()
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopOnce.Do(func() {
+			close(q.stop)
+		})
+		return ctx.Err()
+	}
+}
+
+// Pending возвращает количество событий, которые ещё не были обработаны.
+func (q *Queue) Pending() int64 {
+	return atomic.LoadInt64(&q.pending)
+}
+
+// Dropped возвращает количество событий, отброшенных из-за переполнения очереди.
+func (q *Queue) Dropped() int64 {
+	return atomic.LoadInt64(&q.dropped)
+}
+
+// Failed возвращает количество вызовов слушателей, завершившихся ошибкой после всех повторов.
+func (q *Queue) Failed() int64 {
+	return atomic.LoadInt64(&q.failed)
+}
+
+func (q *Queue) discard(item *queueItem) {
+	atomic.AddInt64(&q.pending, -1)
+	atomic.AddInt64(&q.dropped, 1)
+	item.done <- 0
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for item := range q.items {
+		n := q.deliver(item)
+
+		atomic.AddInt64(&q.pending, -1)
+		item.done <- n
+	}
+}
+
+// deliver вызывает слушателей события и возвращает их количество.
+func (q *Queue) deliver(item *queueItem) int {
+	a := q.bus.targets(item.event)
+
+	for i, t := range a {
+		if item.ctx.Err() != nil {
+			return i
+		}
+
+		err := q.retry(item, t)
+		if errors.Is(err, ErrStopPropagation) {
+			return i + 1
+		}
+		if err != nil {
+			atomic.AddInt64(&q.failed, 1)
+			q.bus.report(item.event, err)
+		}
+	}
+
+	return len(a)
+}
+
+func (q *Queue) retry(item *queueItem, t target) error {
+	backoff := q.conf.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := q.bus.call(item.ctx, t, item.args)
+		if err == nil || errors.Is(err, ErrStopPropagation) || attempt >= q.conf.Retries {
+			return err
+		}
+
+		// случайная добавка до половины задержки разносит повторы разных событий во времени
+		delay := backoff
+		if delay > 0 {
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-q.stop:
+			timer.Stop()
+			return err
+		case <-item.ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		backoff *= 2
+		if q.conf.MaxBackoff > 0 && backoff > q.conf.MaxBackoff {
+			backoff = q.conf.MaxBackoff
+		}
+	}
+}
@@ -1,24 +1,41 @@
 package events
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var (
+	// Shared — общий диспетчер событий. Пакеты database, session, cache и auth
+	// отправляют в него свои события под пространствами имён, например "database.default.Query",
+	// "session.BeforeSave", "cache.default.Miss" и "auth.Login".
 	Shared = New()
 
 	EventExit = Event("Exit")
+
+	// ExitDrainTimeout ограничивает время ожидания обработки очереди в DispatchExit.
+	ExitDrainTimeout = 10 * time.Second
 )
 
+// DispatchExit отправляет событие EventExit и ожидает его обработки.
+// Если для Shared установлена очередь, то после этого она опустошается, см. Queue.Drain.
 func DispatchExit() {
 	done := Shared.Dispatch(EventExit)
 	<-done
+
+	if q := Shared.Queue(); q != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), ExitDrainTimeout)
+		defer cancel()
+
+		q.Drain(ctx)
+	}
 }
 
 func DispatchExitOnInterrupt() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"reflect"
+)
+
+// Topic предоставляет типизированный доступ к событию шины: тип данных события
+// проверяется при компиляции. Если событие отправлено через Dispatcher,
+// то слушатели Topic вызываются только когда передан один аргумент типа T.
+type Topic[T any] struct {
+	bus  *Bus
+	name Event
+}
+
+// NewTopic создаёт типизированное событие с указанным названием.
+func NewTopic[T any](bus *Bus, name Event) Topic[T] {
+	return Topic[T]{bus, name}
+}
+
+// Name возвращает название события.
+func (t Topic[T]) Name() Event {
+	return t.name
+}
+
+// Subscribe добавляет слушателя события.
+func (t Topic[T]) Subscribe(f func(T), options ...SubscribeOption) Subscription {
+	return t.SubscribeContext(func(ctx context.Context, payload T) error {
+		f(payload)
+		return nil
+	}, options...)
+}
+
+// SubscribeContext добавляет слушателя, который получает контекст отправки
+// и может вернуть ошибку. Ошибка прекращает вызов остальных слушателей
+// и возвращается функцией PublishContext, см. также ErrStopPropagation.
+func (t Topic[T]) SubscribeContext(f func(ctx context.Context, payload T) error, options ...SubscribeOption) Subscription {
+	return t.bus.subscribe(t.name, func(ctx context.Context, args []interface{}) error {
+		payload, ok := topicPayload[T](args)
+		if !ok {
+			return nil
+		}
+		return f(ctx, payload)
+	}, options)
+}
+
+// Publish вызывает слушателей события по очереди и возвращает количество вызванных слушателей.
+// Ошибка слушателя передаётся обработчику ошибок шины, см. Bus.SetErrorHandler.
+func (t Topic[T]) Publish(payload T) int {
+	n, err := t.bus.publish(context.Background(), t.name, []interface{}{payload})
+	if err != nil {
+		t.bus.report(t.name, err)
+	}
+
+	return n
+}
+
+// PublishContext вызывает слушателей события по очереди и возвращает первую ошибку.
+// Вызовы прекращаются, если контекст отменён.
+func (t Topic[T]) PublishContext(ctx context.Context, payload T) error {
+	_, err := t.bus.publish(ctx, t.name, []interface{}{payload})
+	return err
+}
+
+// PublishAsync вызывает слушателей события параллельно.
+// Возвращаемый канал получает количество слушателей после завершения всех вызовов.
+func (t Topic[T]) PublishAsync(payload T) chan int {
+	return t.bus.publishAsync(context.Background(), t.name, []interface{}{payload})
+}
+
+func topicPayload[T any](args []interface{}) (T, bool) {
+	var payload T
+
+	if len(args) != 1 {
+		return payload, false
+	}
+
+	if args[0] == nil {
+		// nil допустим для указателей, интерфейсов и других ссылочных типов
+		return payload, isNilable(payload)
+	}
+
+	payload, ok := args[0].(T)
+	return payload, ok
+}
+
+func isNilable(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	}
+
+	return false
+}
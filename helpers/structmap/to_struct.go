@@ -135,6 +135,21 @@ func elem(v reflect.Value) reflect.Value {
 }
 
 func mapValue(m map[string]interface{}, t reflect.StructField) interface{} {
+	for _, k := range FieldKeys(t) {
+		if v, ok := m[k]; ok {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// FieldKeys возвращает ключи карты, из которых может быть скопировано значение поля,
+// в порядке их проверки: название из тега json, название поля, название поля в snake_case.
+// Если в теге json указано "-", то возвращается пустой список.
+func FieldKeys(t reflect.StructField) []string {
+	keys := make([]string, 0, 3)
+
 	tag, ok := t.Tag.Lookup("json")
 	if ok {
 		a := strings.Split(tag, ",")
@@ -147,19 +162,9 @@ func mapValue(m map[string]interface{}, t reflect.StructField) interface{} {
 			return nil
 		}
 
-		if v, ok := m[k]; ok {
-			return v
-		}
-	}
-
-	if v, ok := m[t.Name]; ok {
-		return v
-	}
-
-	k := strcase.ToSnake(t.Name)
-	if v, ok := m[k]; ok {
-		return v
+		keys = append(keys, k)
 	}
 
-	return nil
+	keys = append(keys, t.Name, strcase.ToSnake(t.Name))
+	return keys
 }
@@ -25,12 +25,19 @@ var (
 	instancesMutex = sync.Mutex{}
 )
 
+func init() {
+	config.OnChange("logs", func(string) {
+		reconfigure()
+	})
+}
+
 // Канал.
 type LogChannel struct {
 	name  string
 	log   logger.Logger
 	level int
 	fwd   []string
+	mutex sync.RWMutex
 }
 
 // Channel возвращает канал по его названию.
@@ -50,18 +57,38 @@ func Channel(name string) *LogChannel {
 }
 
 func newChannel(name string) *LogChannel {
-	conf := logger.DefaultConfig()
-	getLoggerConfig(name, &conf)
-
 	c := new(LogChannel)
 	c.name = name
-	c.log = newLogger(conf.Driver, name)
-	c.level = logger.ParseLevel(conf.Level)
-	c.fwd = conf.Forward
+	c.configure()
 
 	return c
 }
 
+// reconfigure применяет новую конфигурацию ко всем созданным каналам.
+func reconfigure() {
+	instancesMutex.Lock()
+	defer instancesMutex.Unlock()
+
+	for _, c := range instances {
+		c.configure()
+	}
+}
+
+func (c *LogChannel) configure() {
+	conf := logger.DefaultConfig()
+	getLoggerConfig(c.name, &conf)
+
+	log := newLogger(conf.Driver, c.name)
+	level := logger.ParseLevel(conf.Level)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.log = log
+	c.level = level
+	c.fwd = conf.Forward
+}
+
 func newLogger(driver string, name string) logger.Logger {
 	switch driver {
 	case DriverFile, "":
@@ -89,7 +116,11 @@ func getLoggerConfig(name string, conf interface{}) (exists bool) {
 
 // Write реализует интерфейс io.Writer.
 func (c *LogChannel) Write(b []byte) (int, error) {
-	return c.log.Write(b)
+	c.mutex.RLock()
+	log := c.log
+	c.mutex.RUnlock()
+
+	return log.Write(b)
 }
 
 // Print добавляет в журнал сообщение с заданным уровнем важности.
@@ -99,24 +130,32 @@ func (c *LogChannel) Print(level int, a ...interface{}) {
 }
 
 func (c *LogChannel) print(level int, a ...interface{}) {
-	if level > c.level {
+	c.mutex.RLock()
+	log, maxLevel := c.log, c.level
+	c.mutex.RUnlock()
+
+	if level > maxLevel {
 		return
 	}
 
-	err := c.log.Print(level, a...)
+	err := log.Print(level, a...)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
 func (c *LogChannel) forward(stack helpers.Slice[string], level int, a ...interface{}) {
-	if len(c.fwd) == 0 {
+	c.mutex.RLock()
+	fwd := c.fwd
+	c.mutex.RUnlock()
+
+	if len(fwd) == 0 {
 		return
 	}
 
 	stack = append(stack, c.name)
 
-	for _, name := range c.fwd {
+	for _, name := range fwd {
 		if stack.IndexOf(name) >= 0 {
 			continue
 		}
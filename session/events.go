@@ -4,6 +4,16 @@ import (
 	"github.com/olegshs/go-tools/events"
 )
 
+const (
+	// Namespace — пространство имён событий менеджера сессий в events.Shared,
+	// например "session.BeforeSave".
+	Namespace = "session"
+)
+
+// Слушатели событий Before* вызываются синхронно и могут вернуть ошибку,
+// которая отменяет действие и возвращается вызывающей функции. Отменить действие могут
+// только слушатели, добавленные через Manager.Events; ошибки слушателей events.Shared
+// передаются обработчику ошибок шины, см. events.Dispatcher.DispatchCancelable.
 const (
 	EventAfterLoad     = events.Event("AfterLoad")     // (*Session)
 	EventBeforeSave    = events.Event("BeforeSave")    // (*Session)
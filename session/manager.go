@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"net/http"
@@ -19,10 +20,10 @@ func NewManager(conf Config, stor StorageInterface) ManagerInterface {
 	mgr := new(Manager)
 	mgr.conf = conf
 	mgr.storage = stor
-	mgr.events = events.New()
+	mgr.events = events.Shared.Namespace(Namespace)
 
-	mgr.storage.Events().AddListener(storage.EventBeforeDelete, func(id string) {
-		mgr.events.Dispatch(EventBeforeDestroy, id)
+	mgr.storage.Events().AddListener(storage.EventBeforeDelete, func(ctx context.Context, id string) error {
+		return mgr.events.DispatchCancelable(ctx, EventBeforeDestroy, id)
 	})
 
 	return mgr
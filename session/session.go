@@ -3,6 +3,7 @@ package session
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 
 	"github.com/olegshs/go-tools/events"
@@ -101,19 +102,22 @@ func (s *Session) save() error {
 		return nil
 	}
 
-	s.events.Dispatch(EventBeforeSave, s)
+	err := s.events.DispatchCancelable(context.Background(), EventBeforeSave, s)
+	if err != nil {
+		return err
+	}
 
 	buf := new(bytes.Buffer)
 
 	if len(s.data) > 0 {
 		enc := gob.NewEncoder(buf)
-		err := enc.Encode(s.data)
+		err = enc.Encode(s.data)
 		if err != nil {
 			return err
 		}
 	}
 
-	err := s.storage.Set(s.id, buf.Bytes())
+	err = s.storage.Set(s.id, buf.Bytes())
 	if err != nil {
 		return err
 	}
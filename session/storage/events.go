@@ -4,6 +4,16 @@ import (
 	"github.com/olegshs/go-tools/events"
 )
 
+const (
+	// Namespace — пространство имён событий хранилищ сессий в events.Shared,
+	// например "session.storage.BeforeSave".
+	Namespace = "session.storage"
+)
+
+// Слушатели событий Before* вызываются синхронно и могут вернуть ошибку,
+// которая отменяет действие и возвращается вызывающей функции. Отменить действие могут
+// только слушатели, добавленные через Events хранилища; ошибки слушателей events.Shared
+// передаются обработчику ошибок шины, см. events.Dispatcher.DispatchCancelable.
 const (
 	EventAfterLoad    = events.Event("AfterLoad")    // (id string, data []byte)
 	EventBeforeSave   = events.Event("BeforeSave")   // (id string, data []byte)
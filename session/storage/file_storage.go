@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -37,7 +38,7 @@ func NewFileStorage(conf ConfigFile) *FileStorage {
 		storage.gc.Start()
 	}
 
-	storage.events = events.New()
+	storage.events = events.Shared.Namespace(Namespace)
 
 	return storage
 }
@@ -90,7 +91,10 @@ func (stor *FileStorage) Get(id string) ([]byte, error) {
 }
 
 func (stor *FileStorage) Set(id string, data []byte) error {
-	stor.events.Dispatch(EventBeforeSave, id, data)
+	err := stor.events.DispatchCancelable(context.Background(), EventBeforeSave, id, data)
+	if err != nil {
+		return err
+	}
 
 	p := stor.PathById(id)
 
@@ -114,7 +118,7 @@ func (stor *FileStorage) Set(id string, data []byte) error {
 		}
 	}
 
-	err := ioutil.WriteFile(p, data, 0600)
+	err = ioutil.WriteFile(p, data, 0600)
 	if err != nil {
 		return err
 	}
@@ -123,7 +127,10 @@ func (stor *FileStorage) Set(id string, data []byte) error {
 }
 
 func (stor *FileStorage) Touch(id string) error {
-	stor.events.Dispatch(EventBeforeTouch, id)
+	err := stor.events.DispatchCancelable(context.Background(), EventBeforeTouch, id)
+	if err != nil {
+		return err
+	}
 
 	p := stor.PathById(id)
 	if _, err := os.Stat(p); os.IsNotExist(err) {
@@ -131,7 +138,7 @@ func (stor *FileStorage) Touch(id string) error {
 	}
 
 	t := time.Now()
-	err := os.Chtimes(p, t, t)
+	err = os.Chtimes(p, t, t)
 	if err != nil {
 		return err
 	}
@@ -148,7 +155,10 @@ func (stor *FileStorage) Delete(id string) error {
 		return ErrNotFound
 	}
 
-	stor.events.Dispatch(EventBeforeDelete, id)
+	err = stor.events.DispatchCancelable(context.Background(), EventBeforeDelete, id)
+	if err != nil {
+		return err
+	}
 
 	p := stor.PathById(id)
 
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -39,7 +40,7 @@ func NewSqlStorage(conf ConfigSql) *SqlStorage {
 		storage.gc.Start()
 	}
 
-	storage.events = events.New()
+	storage.events = events.Shared.Namespace(Namespace)
 
 	return storage
 }
@@ -130,7 +131,10 @@ func (stor *SqlStorage) Get(id string) ([]byte, error) {
 func (stor *SqlStorage) Set(id string, data []byte) error {
 	t := time.Now().UnixNano() / 1000000
 
-	stor.events.Dispatch(EventBeforeSave, id, data)
+	err := stor.events.DispatchCancelable(context.Background(), EventBeforeSave, id, data)
+	if err != nil {
+		return err
+	}
 
 	db, err := database.Get(stor.db)
 	if err != nil {
@@ -199,7 +203,10 @@ func (stor *SqlStorage) Set(id string, data []byte) error {
 func (stor *SqlStorage) Touch(id string) error {
 	t := time.Now().UnixNano() / 1000000
 
-	stor.events.Dispatch(EventBeforeTouch, id)
+	err := stor.events.DispatchCancelable(context.Background(), EventBeforeTouch, id)
+	if err != nil {
+		return err
+	}
 
 	db, err := database.Get(stor.db)
 	if err != nil {
@@ -227,7 +234,10 @@ func (stor *SqlStorage) Touch(id string) error {
 }
 
 func (stor *SqlStorage) Delete(id string) error {
-	stor.events.Dispatch(EventBeforeDelete, id)
+	err := stor.events.DispatchCancelable(context.Background(), EventBeforeDelete, id)
+	if err != nil {
+		return err
+	}
 
 	db, err := database.Get(stor.db)
 	if err != nil {